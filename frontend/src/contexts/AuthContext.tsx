@@ -73,6 +73,10 @@ export const AuthProvider = ({ children }: AuthProviderProps) => {
   };
 
   const logout = () => {
+    // Revoke the session server-side; the local state is cleared regardless
+    if (token) {
+      authService.logout(token).catch((error) => console.error('Logout error:', error));
+    }
     setUser(null);
     setToken(null);
     localStorage.removeItem('token');
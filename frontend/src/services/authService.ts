@@ -1,4 +1,17 @@
-import { LoginResponse, User } from '../types/models';
+import {
+  AuditEventParams,
+  AuditPage,
+  ExternalIdentity,
+  ImpersonationResponse,
+  LoginResponse,
+  OIDCAuthorization,
+  OIDCProvider,
+  Session,
+  User,
+  UserImportResult,
+  UserListParams,
+  UserPage,
+} from '../types/models';
 import { authApi, apiRequest } from './apiClient';
 
 // Auth service methods
@@ -12,6 +25,83 @@ export const authService = {
     });
   },
 
+  // Complete a login by replacing a password the user was given, e.g. in an import
+  async completePasswordChange(passwordChangeToken: string, newPassword: string): Promise<LoginResponse> {
+    return apiRequest<LoginResponse>(authApi, {
+      method: 'POST',
+      url: '/login/password',
+      data: { password_change_token: passwordChangeToken, new_password: newPassword },
+    });
+  },
+
+  // List the identity providers users can log in with
+  async getOIDCProviders(): Promise<OIDCProvider[]> {
+    return apiRequest<OIDCProvider[]>(authApi, {
+      method: 'GET',
+      url: '/login/oidc',
+    });
+  },
+
+  // Start a login with an identity provider; the browser is then sent to authorization_url
+  async startOIDCLogin(provider: string): Promise<OIDCAuthorization> {
+    return apiRequest<OIDCAuthorization>(authApi, {
+      method: 'POST',
+      url: `/login/oidc/${encodeURIComponent(provider)}`,
+    });
+  },
+
+  // Complete a login with the code and state the identity provider redirected back with
+  async completeOIDCLogin(provider: string, code: string, state: string): Promise<LoginResponse> {
+    return apiRequest<LoginResponse>(authApi, {
+      method: 'POST',
+      url: `/login/oidc/${encodeURIComponent(provider)}/callback`,
+      data: { code, state },
+    });
+  },
+
+  // List the identity provider accounts linked to the current user
+  async getMyIdentities(): Promise<ExternalIdentity[]> {
+    return apiRequest<ExternalIdentity[]>(authApi, {
+      method: 'GET',
+      url: '/users/me/identities',
+    });
+  },
+
+  // Start linking an identity provider account to the logged in user, confirmed with the current
+  // password or a two-factor code; the browser is then sent to authorization_url
+  async startOIDCLink(provider: string, confirmation: { password?: string; code?: string }): Promise<OIDCAuthorization> {
+    return apiRequest<OIDCAuthorization>(authApi, {
+      method: 'POST',
+      url: `/users/me/identities/${encodeURIComponent(provider)}/authorize`,
+      data: confirmation,
+    });
+  },
+
+  // Complete a link with the code and state the identity provider redirected back with
+  async linkOIDCIdentity(provider: string, code: string, state: string): Promise<ExternalIdentity> {
+    return apiRequest<ExternalIdentity>(authApi, {
+      method: 'POST',
+      url: `/users/me/identities/${encodeURIComponent(provider)}`,
+      data: { code, state },
+    });
+  },
+
+  // Get the devices the logged in user is signed in on
+  async getMySessions(): Promise<Session[]> {
+    return apiRequest<Session[]>(authApi, {
+      method: 'GET',
+      url: '/users/me/sessions',
+    });
+  },
+
+  // Sign out one of the logged in user's sessions, e.g. a forgotten tablet
+  async revokeMySession(sessionId: string): Promise<void> {
+    return apiRequest<void>(authApi, {
+      method: 'DELETE',
+      url: `/users/me/sessions/${sessionId}`,
+    });
+  },
+
   // Get current user information
   async getCurrentUser(token?: string): Promise<User> {
     const config: any = {
@@ -36,6 +126,51 @@ export const authService = {
     });
   },
 
+  // End the current session on the server
+  async logout(token: string): Promise<void> {
+    return apiRequest<void>(authApi, {
+      method: 'POST',
+      url: '/logout',
+      headers: { Authorization: `Bearer ${token}` },
+    });
+  },
+
+  // Ask for a password reset link by e-mail
+  async forgotPassword(email: string): Promise<void> {
+    await apiRequest<{ message: string }>(authApi, {
+      method: 'POST',
+      url: '/password/forgot',
+      data: { email },
+    });
+  },
+
+  // Set a new password with the token from a reset link
+  async resetPassword(token: string, newPassword: string): Promise<void> {
+    return apiRequest<void>(authApi, {
+      method: 'POST',
+      url: '/password/reset',
+      data: { token, new_password: newPassword },
+    });
+  },
+
+  // Create an account with the token from an invitation link
+  async acceptInvitation(token: string, username: string, password: string): Promise<User> {
+    return apiRequest<User>(authApi, {
+      method: 'POST',
+      url: `/invitations/${encodeURIComponent(token)}/accept`,
+      data: { username, password },
+    });
+  },
+
+  // Change the password of the logged in user
+  async changePassword(currentPassword: string, newPassword: string): Promise<void> {
+    return apiRequest<void>(authApi, {
+      method: 'POST',
+      url: '/users/me/password',
+      data: { current_password: currentPassword, new_password: newPassword },
+    });
+  },
+
   // Verify if a token is valid
   async verifyToken(token: string): Promise<boolean> {
     try {
@@ -50,11 +185,35 @@ export const authService = {
     }
   },
 
-  // Get a list of all users (admin only)
-  async getUsers(): Promise<User[]> {
-    return apiRequest<User[]>(authApi, {
+  // Get a page of users (admin only)
+  async getUsers(params: UserListParams = {}): Promise<UserPage> {
+    return apiRequest<UserPage>(authApi, {
       method: 'GET',
       url: '/users',
+      params,
+    });
+  },
+
+  // Create users from a CSV file (requires users:write). Invalid rows are
+  // reported in the result; with dryRun nothing is stored.
+  async importUsers(file: Blob, dryRun = false): Promise<UserImportResult> {
+    const form = new FormData();
+    form.append('file', file);
+    return apiRequest<UserImportResult>(authApi, {
+      method: 'POST',
+      url: '/users/import',
+      params: { dry_run: dryRun },
+      data: form,
+    });
+  },
+
+  // Export the matching users as CSV (requires users:read)
+  async exportUsers(params: UserListParams = {}): Promise<Blob> {
+    return apiRequest<Blob>(authApi, {
+      method: 'GET',
+      url: '/users/export',
+      params,
+      responseType: 'blob',
     });
   },
 
@@ -76,7 +235,10 @@ export const authService = {
   },
 
   // Update a user
-  async updateUser(id: number, userData: Partial<User> & { password?: string }): Promise<User> {
+  async updateUser(
+    id: number,
+    userData: Partial<User> & { password?: string; current_password?: string }
+  ): Promise<User> {
     return apiRequest<User>(authApi, {
       method: 'PUT',
       url: `/users/${id}`,
@@ -91,4 +253,31 @@ export const authService = {
       url: `/users/${id}`,
     });
   },
+
+  // Get a page of audit events (requires audit:read)
+  async getAuditEvents(params: AuditEventParams = {}): Promise<AuditPage> {
+    return apiRequest<AuditPage>(authApi, {
+      method: 'GET',
+      url: '/audit',
+      params,
+    });
+  },
+
+  // Export the matching audit events as CSV (requires audit:read)
+  async exportAuditEvents(params: AuditEventParams = {}): Promise<Blob> {
+    return apiRequest<Blob>(authApi, {
+      method: 'GET',
+      url: '/audit',
+      params: { ...params, format: 'csv' },
+      responseType: 'blob',
+    });
+  },
+
+  // Get a short-lived token to act as another user (requires users:impersonate)
+  async impersonateUser(id: number): Promise<ImpersonationResponse> {
+    return apiRequest<ImpersonationResponse>(authApi, {
+      method: 'POST',
+      url: `/users/${id}/impersonate`,
+    });
+  },
 }; 
\ No newline at end of file
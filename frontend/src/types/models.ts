@@ -6,6 +6,108 @@ export interface User {
   role: UserRole;
   created_at: string;
   updated_at: string;
+  active: boolean;
+  deactivated_at?: string;
+  password_change_required?: boolean;
+}
+
+export interface UserListParams {
+  search?: string;
+  role?: string;
+  status?: 'active' | 'deactivated';
+  created_from?: string;
+  created_to?: string;
+  sort?: 'username' | 'email' | 'role' | 'created_at';
+  order?: 'asc' | 'desc';
+  limit?: number;
+  offset?: number;
+  cursor?: string;
+}
+
+export interface UserPage {
+  users: User[];
+  total: number;
+  limit: number;
+  offset?: number;
+  next_cursor?: string;
+}
+
+export interface Invitation {
+  id: number;
+  email: string;
+  role: string;
+  status: string;
+  expires_at: string;
+  sent_at: string;
+  created_at: string;
+}
+
+export interface UserImportError {
+  line: number;
+  username?: string;
+  email?: string;
+  error: string;
+}
+
+export interface UserImportResult {
+  dry_run: boolean;
+  rows: number;
+  created: number;
+  invited: number;
+  errors: UserImportError[];
+  users?: User[];
+  invitations?: Invitation[];
+}
+
+export interface AuditEvent {
+  id: number;
+  occurred_at: string;
+  actor_id?: number;
+  actor_name?: string;
+  action: string;
+  target_type?: string;
+  target_id?: string;
+  changes?: Record<string, { from: unknown; to: unknown }>;
+  ip?: string;
+  user_agent?: string;
+}
+
+export interface AuditEventParams {
+  actor_id?: number;
+  action?: string;
+  target_type?: string;
+  target_id?: string;
+  from?: string;
+  to?: string;
+  limit?: number;
+  offset?: number;
+}
+
+export interface AuditPage {
+  events: AuditEvent[];
+  total: number;
+  limit: number;
+  offset: number;
+}
+
+export interface Session {
+  id: string;
+  user_id: number;
+  device_name?: string;
+  ip?: string;
+  user_agent?: string;
+  auth_methods: string[];
+  created_at: string;
+  last_seen_at: string;
+  expires_at: string;
+  current: boolean;
+}
+
+export interface ImpersonationResponse {
+  token: string;
+  expires_at: string;
+  user: User;
+  actor_id: number;
 }
 
 export type UserRole = 'admin' | 'bartender' | 'guest';
@@ -19,6 +121,33 @@ export interface LoginResponse {
   token: string;
   refresh_token: string;
   user: User;
+  mfa_required?: boolean;
+  mfa_token?: string;
+  mfa_enrollment_required?: boolean;
+  recovery_codes?: string[];
+  password_change_required?: boolean;
+  password_change_token?: string;
+}
+
+export interface OIDCProvider {
+  name: string;
+  display_name: string;
+}
+
+export interface OIDCAuthorization {
+  authorization_url: string;
+  state: string;
+  expires_at: string;
+}
+
+export interface ExternalIdentity {
+  id: number;
+  user_id: number;
+  provider: string;
+  subject: string;
+  email?: string;
+  created_at: string;
+  last_login_at?: string;
 }
 
 // Ingredient models
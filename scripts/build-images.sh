@@ -17,12 +17,18 @@ echo -e "${BLUE}Building Docker images for Bartender App...${NC}"
 echo -e "${BLUE}Building frontend image...${NC}"
 docker build -t bartenderapp/frontend:latest ./frontend
 
+# Version and commit reported by the health endpoints of the services
+VERSION=${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo dev)}
+COMMIT=${COMMIT:-$(git rev-parse --short HEAD 2>/dev/null || echo unknown)}
+
 # Build backend services
 SERVICES=("auth" "inventory" "order" "pricing")
 
 for service in "${SERVICES[@]}"; do
   echo -e "${BLUE}Building ${service} service image...${NC}"
-  docker build -t "bartenderapp/${service}-service:latest" -f "./services/${service}/Dockerfile" ./services
+  docker build -t "bartenderapp/${service}-service:latest" \
+    --build-arg VERSION="$VERSION" --build-arg COMMIT="$COMMIT" \
+    -f "./services/${service}/Dockerfile" ./services
   
   if [ $? -eq 0 ]; then
     echo -e "${GREEN}Successfully built ${service} service image.${NC}"
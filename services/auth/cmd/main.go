@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,72 +11,287 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/handlers"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
 	"github.com/ignaseim/bartenderapp/services/pkg/database"
+	"github.com/ignaseim/bartenderapp/services/pkg/health"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/mailer"
+	"github.com/ignaseim/bartenderapp/services/pkg/metrics"
 	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+// Build version and commit, set with
+// -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
 )
 
 func main() {
+	// Write JSON logs at LOG_LEVEL
+	logging.Setup("auth")
+
+	// Export traces if an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), "auth")
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
 	// Initialize database connection
 	dbConfig := database.NewConfigFromEnv()
 	db, err := database.Connect(dbConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer database.Close(db)
 
 	// Create repositories
 	userRepo := repository.NewUserRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	terminalRepo := repository.NewTerminalRepository(db)
+	apiClientRepo := repository.NewAPIClientRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	externalIdentityRepo := repository.NewExternalIdentityRepository(db)
+
+	// Load the token signing keys; this service verifies tokens with its own keys
+	signer, err := auth.NewSignerFromEnv()
+	if err != nil {
+		fatal("Failed to load token signing keys", err)
+	}
+	if os.Getenv("JWT_SIGNING_KEYS_DIR") == "" {
+		slog.Warn("JWT_SIGNING_KEYS_DIR is not set, using ephemeral signing key", "kid", signer.ActiveKeyID())
+	}
+	auth.SetKeySource(signer)
+
+	// Accept service tokens issued for this service
+	audience := os.Getenv("TOKEN_AUDIENCE")
+	if audience == "" {
+		audience = "auth"
+	}
+	auth.SetAudience(audience)
+
+	// Check revoked tokens on every validation
+	denylist := auth.NewSQLDenylist(db)
+	auth.SetDenylist(denylist)
+	go purgeDenylist(denylist)
+
+	// Accept API keys of machine clients
+	auth.SetAPIKeyValidator(auth.NewSQLAPIKeyValidator(db))
+
+	// Create the mail sender for password reset and invitation links
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		fatal("Failed to configure mail", err)
+	}
+
+	// Configure how passwords are hashed; older hashes are upgraded at login
+	passwordHasher, err := service.PasswordHasherFromEnv()
+	if err != nil {
+		fatal("Failed to configure password hashing", err)
+	}
+	service.SetPasswordHasher(passwordHasher)
+
+	// Load the rules for new passwords
+	passwordPolicy, err := service.PasswordPolicyFromEnv()
+	if err != nil {
+		fatal("Failed to load password policy", err)
+	}
+
+	// Load the external identity providers users can log in with
+	oidcProviders, err := service.OIDCProvidersFromEnv()
+	if err != nil {
+		fatal("Failed to configure OIDC providers", err)
+	}
+
+	// Record security and user administration events in the audit log
+	auditRecorder := audit.NewSQLRecorder(db)
 
 	// Create services
-	userService := service.NewUserService(userRepo)
-	authService := service.NewAuthService(userRepo)
+	loginGuard := service.NewLoginGuard(loginAttemptRepo, service.LoginPolicyFromEnv())
+	go purgeLoginAttempts(loginGuard)
+	mfaService := service.NewMFAService(mfaRepo, userRepo, service.MFARequiredRolesFromEnv())
+	userService := service.NewUserService(userRepo, roleRepo, refreshTokenRepo, denylist, passwordPolicy, auditRecorder)
+	authService := service.NewAuthService(userRepo, roleRepo, refreshTokenRepo, sessionRepo, denylist, signer, loginGuard, mfaService, passwordPolicy, auditRecorder)
+	terminalService := service.NewTerminalService(terminalRepo)
+	pinService := service.NewPINService(userRepo, roleRepo, terminalService, signer, loginGuard, mfaService, service.PINPolicyFromEnv())
+	apiClientService := service.NewAPIClientService(apiClientRepo, roleRepo)
+	roleService := service.NewRoleService(roleRepo)
+	passwordResetService := service.NewPasswordResetService(userRepo, passwordResetRepo, refreshTokenRepo, denylist, loginGuard, mail, service.PasswordResetPolicyFromEnv(), passwordPolicy)
+	invitationService := service.NewInvitationService(invitationRepo, userRepo, userService, mail, service.InvitationPolicyFromEnv())
+	userImportService := service.NewUserImportService(userRepo, invitationRepo, userService, invitationService)
+	auditService := service.NewAuditService(auditRecorder)
+	oidcService := service.NewOIDCService(oidcProviders, externalIdentityRepo, userRepo, roleRepo, authService, auditRecorder)
+	sessionService := service.NewSessionService(sessionRepo, userRepo, auditRecorder)
+	impersonationService := service.NewImpersonationService(userRepo, roleRepo, signer, auditRecorder, service.ImpersonationPolicyFromEnv())
+	tokenService := service.NewTokenService(apiClientRepo, refreshTokenRepo, userRepo, signer, service.ClientTokenPolicyFromEnv())
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userService)
+	userHandler := handlers.NewUserHandler(userService, userImportService)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	pinHandler := handlers.NewPINHandler(pinService)
+	terminalHandler := handlers.NewTerminalHandler(terminalService)
+	apiClientHandler := handlers.NewAPIClientHandler(apiClientService)
+	roleHandler := handlers.NewRoleHandler(roleService)
+	passwordHandler := handlers.NewPasswordHandler(passwordResetService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	tokenHandler := handlers.NewTokenHandler(tokenService)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+
+	// Readiness checks of the dependencies
+	checks := health.New(version, commit, 5*time.Second, 2*time.Second)
+	checks.Register("database", health.DB(db, time.Second))
+	if natsURL := os.Getenv("NATS_URL"); natsURL != "" {
+		checks.Register("nats", health.NATS(natsURL, time.Second))
+	}
 
 	// Create router
 	router := mux.NewRouter()
 
 	// Apply middleware to all routes
+	router.Use(logging.RequestID)
+	router.Use(tracing.Middleware)
 	router.Use(middleware.RequestLogger)
+	router.Use(metrics.Middleware)
 	router.Use(middleware.CORS)
 	router.Use(middleware.JSONContentType)
+	router.Use(audit.Middleware)
 
 	// Public routes
 	router.HandleFunc("/login", authHandler.Login).Methods("POST")
+	router.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods("POST")
+	router.HandleFunc("/login/mfa/enroll", authHandler.EnrollMFA).Methods("POST")
+	router.HandleFunc("/login/password", authHandler.LoginPasswordChange).Methods("POST")
+	router.HandleFunc("/login/pin", pinHandler.Login).Methods("POST")
+	router.HandleFunc("/login/oidc", oidcHandler.ListProviders).Methods("GET")
+	router.HandleFunc("/login/oidc/{provider}", oidcHandler.Authorize).Methods("POST")
+	router.HandleFunc("/login/oidc/{provider}/callback", oidcHandler.Callback).Methods("POST")
 	router.HandleFunc("/refresh", authHandler.RefreshToken).Methods("POST")
+	router.HandleFunc("/password/forgot", passwordHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", passwordHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/invitations/{token}/accept", invitationHandler.AcceptInvitation).Methods("POST")
+	router.HandleFunc("/oauth/token", tokenHandler.IssueToken).Methods("POST")
 	router.HandleFunc("/verify", authHandler.VerifyToken).Methods("POST")
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		middleware.RespondWithJSON(w, http.StatusOK, map[string]string{
-			"status":  "ok",
-			"version": "1.0.0",
-		})
-	}).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
+
+	// Probes. /health is kept for existing monitors and reports liveness.
+	router.HandleFunc("/livez", checks.Live).Methods("GET")
+	router.HandleFunc("/readyz", checks.Ready).Methods("GET")
+	router.HandleFunc("/health", checks.Live).Methods("GET")
 
 	// Metrics endpoint
-	router.Handle("/metrics", promhttp.Handler())
+	router.Handle("/metrics", metrics.Handler())
 
-	// Protected routes - require authentication
+	// Protected routes - require authentication. Requests made while
+	// impersonating a user are audited; destructive ones, changes to accounts,
+	// roles and permissions and the issuing of credentials that outlive the
+	// impersonation are denied.
+	// The tokens of PIN logins on terminals are denied the same routes.
 	protected := router.PathPrefix("").Subrouter()
 	protected.Use(middleware.Authenticate)
+	protected.Use(audit.ImpersonationMiddleware(auditRecorder))
+
+	restricted := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.DenyImpersonation(middleware.DenyTerminal(next))
+	}
+
+	// Session routes
+	protected.HandleFunc("/logout", authHandler.Logout).Methods("POST")
+	protected.HandleFunc("/users/me/sessions", sessionHandler.ListMySessions).Methods("GET")
+	protected.HandleFunc("/users/me/sessions/{session_id:"+service.SessionIDPattern+"}", restricted(sessionHandler.RevokeMySession)).Methods("DELETE")
 
 	// User routes
 	protected.HandleFunc("/users", userHandler.ListUsers).Methods("GET")
-	protected.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
+	protected.HandleFunc("/users", restricted(userHandler.CreateUser)).Methods("POST")
+	protected.HandleFunc("/users/export", userHandler.ExportUsers).Methods("GET")
+	protected.HandleFunc("/users/import", restricted(userHandler.ImportUsers)).Methods("POST")
 	protected.HandleFunc("/users/{id:[0-9]+}", userHandler.GetUser).Methods("GET")
-	protected.HandleFunc("/users/{id:[0-9]+}", userHandler.UpdateUser).Methods("PUT")
-	protected.HandleFunc("/users/{id:[0-9]+}", userHandler.DeleteUser).Methods("DELETE")
+	protected.HandleFunc("/users/{id:[0-9]+}", restricted(userHandler.UpdateUser)).Methods("PUT")
+	protected.HandleFunc("/users/{id:[0-9]+}", restricted(userHandler.DeleteUser)).Methods("DELETE")
+	protected.HandleFunc("/users/{id:[0-9]+}/reactivate", restricted(userHandler.ReactivateUser)).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}/erase", restricted(userHandler.EraseUser)).Methods("POST")
 	protected.HandleFunc("/users/me", userHandler.GetCurrentUser).Methods("GET")
+	protected.HandleFunc("/users/me/password", restricted(userHandler.ChangePassword)).Methods("POST")
+	protected.HandleFunc("/users/me/identities", oidcHandler.ListMyIdentities).Methods("GET")
+	protected.HandleFunc("/users/me/identities/{provider}/authorize", restricted(oidcHandler.AuthorizeLink)).Methods("POST")
+	protected.HandleFunc("/users/me/identities/{provider}", restricted(oidcHandler.LinkIdentity)).Methods("POST")
+
+	// Two-factor authentication routes
+	protected.HandleFunc("/users/me/mfa/totp", restricted(mfaHandler.Enroll)).Methods("POST")
+	protected.HandleFunc("/users/me/mfa/totp/confirm", restricted(mfaHandler.Confirm)).Methods("POST")
+	protected.HandleFunc("/users/me/mfa/totp/disable", restricted(mfaHandler.Disable)).Methods("POST")
+	protected.HandleFunc("/users/me/mfa/recovery-codes", restricted(mfaHandler.RegenerateRecoveryCodes)).Methods("POST")
+
+	// PIN routes
+	protected.HandleFunc("/users/me/pin", restricted(pinHandler.SetPIN)).Methods("PUT")
+	protected.HandleFunc("/users/me/pin", restricted(pinHandler.RemovePIN)).Methods("DELETE")
+
+	// Role and permission routes
+	protected.HandleFunc("/roles", roleHandler.ListRoles).Methods("GET")
+	protected.HandleFunc("/permissions", roleHandler.ListPermissions).Methods("GET")
+
+	rolesRouter := permissionRouter(protected, auth.PermRolesManage)
+	rolesRouter.HandleFunc("/roles", restricted(roleHandler.CreateRole)).Methods("POST")
+	rolesRouter.HandleFunc("/roles/{name:[a-z0-9_]+}", restricted(roleHandler.UpdateRole)).Methods("PUT")
+	rolesRouter.HandleFunc("/roles/{name:[a-z0-9_]+}", restricted(roleHandler.DeleteRole)).Methods("DELETE")
+	rolesRouter.HandleFunc("/permissions", restricted(roleHandler.CreatePermission)).Methods("POST")
+
+	// Account security routes
+	securityRouter := permissionRouter(protected, auth.PermUsersSecurity)
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/sessions", sessionHandler.ListSessions).Methods("GET")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/sessions/{session_id:"+service.SessionIDPattern+"}", restricted(sessionHandler.RevokeSession)).Methods("DELETE")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/sessions/revoke-all", restricted(authHandler.RevokeAllSessions)).Methods("POST")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/unlock", restricted(authHandler.UnlockUser)).Methods("POST")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/mfa", restricted(mfaHandler.Reset)).Methods("DELETE")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/pin", restricted(pinHandler.SetUserPIN)).Methods("PUT")
+	securityRouter.HandleFunc("/users/password-schemes", userHandler.PasswordSchemeReport).Methods("GET")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/identities", oidcHandler.ListIdentities).Methods("GET")
+	securityRouter.HandleFunc("/users/{id:[0-9]+}/identities/{identity_id:[0-9]+}", restricted(oidcHandler.UnlinkIdentity)).Methods("DELETE")
+
+	// Impersonation routes; an impersonation token cannot start another one
+	impersonationRouter := permissionRouter(protected, auth.PermUsersImpersonate)
+	impersonationRouter.HandleFunc("/users/{id:[0-9]+}/impersonate", restricted(impersonationHandler.Impersonate)).Methods("POST")
+
+	// Invitation routes
+	invitationsRouter := permissionRouter(protected, auth.PermUsersWrite)
+	invitationsRouter.HandleFunc("/invitations", invitationHandler.ListInvitations).Methods("GET")
+	invitationsRouter.HandleFunc("/invitations", restricted(invitationHandler.CreateInvitation)).Methods("POST")
+	invitationsRouter.HandleFunc("/invitations/{id:[0-9]+}/resend", restricted(invitationHandler.ResendInvitation)).Methods("POST")
+	invitationsRouter.HandleFunc("/invitations/{id:[0-9]+}", restricted(invitationHandler.RevokeInvitation)).Methods("DELETE")
+
+	// Terminal routes
+	terminalsRouter := permissionRouter(protected, auth.PermTerminalsManage)
+	terminalsRouter.HandleFunc("/terminals", terminalHandler.ListTerminals).Methods("GET")
+	terminalsRouter.HandleFunc("/terminals", restricted(terminalHandler.RegisterTerminal)).Methods("POST")
+	terminalsRouter.HandleFunc("/terminals/{id:[0-9]+}", restricted(terminalHandler.RevokeTerminal)).Methods("DELETE")
+
+	// Machine client routes
+	apiClientsRouter := permissionRouter(protected, auth.PermAPIClientsManage)
+	apiClientsRouter.HandleFunc("/api-clients", apiClientHandler.ListAPIClients).Methods("GET")
+	apiClientsRouter.HandleFunc("/api-clients", restricted(apiClientHandler.CreateAPIClient)).Methods("POST")
+	apiClientsRouter.HandleFunc("/api-clients/{id:[0-9]+}/rotate-key", restricted(apiClientHandler.RotateAPIClientKey)).Methods("POST")
+	apiClientsRouter.HandleFunc("/api-clients/{id:[0-9]+}", restricted(apiClientHandler.RevokeAPIClient)).Methods("DELETE")
 
-	// Admin-only routes
-	adminRouter := router.PathPrefix("").Subrouter()
-	adminRouter.Use(middleware.Authenticate)
-	adminRouter.Use(middleware.RequireRole("admin"))
+	// Audit log routes
+	auditRouter := permissionRouter(protected, auth.PermAuditRead)
+	auditRouter.HandleFunc("/audit", auditHandler.ListEvents).Methods("GET")
+
+	// Token introspection for other services
+	introspectionRouter := permissionRouter(protected, auth.PermTokensIntrospect)
+	introspectionRouter.HandleFunc("/introspect", tokenHandler.Introspect).Methods("POST")
 
 	// Start the server
 	port := os.Getenv("PORT")
@@ -94,9 +309,9 @@ func main() {
 
 	// Run server in a goroutine so we can gracefully shut it down
 	go func() {
-		log.Printf("Auth Service starting on port %s", port)
+		slog.Info("Auth Service starting", "port", port, "version", version, "commit", commit)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %v", err)
+			fatal("Error starting server", err)
 		}
 	}()
 
@@ -113,6 +328,58 @@ func main() {
 
 	// Shutdown the server
 	srv.Shutdown(ctx)
-	log.Println("Auth Service shutting down")
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	slog.Info("Auth Service shutting down")
 	os.Exit(0)
-} 
\ No newline at end of file
+}
+
+// fatal logs an error the service cannot start without and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// purgeDenylist periodically removes expired entries from the token denylist
+func purgeDenylist(denylist *auth.SQLDenylist) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := denylist.PurgeExpired(context.Background())
+		if err != nil {
+			slog.Error("Error purging token denylist", "error", err)
+			continue
+		}
+		if purged > 0 {
+			slog.Info("Purged expired entries from token denylist", "count", purged)
+		}
+	}
+}
+
+// purgeLoginAttempts periodically removes failed logins older than the
+// failure window, so guessed usernames do not pile up
+func purgeLoginAttempts(loginGuard *service.LoginGuard) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := loginGuard.PurgeExpired(context.Background())
+		if err != nil {
+			slog.Error("Error purging failed logins", "error", err)
+			continue
+		}
+		if purged > 0 {
+			slog.Info("Purged expired failed logins", "count", purged)
+		}
+	}
+}
+
+// permissionRouter returns a subrouter of the authenticated routes whose
+// routes also require one of the given permissions
+func permissionRouter(protected *mux.Router, permissions ...string) *mux.Router {
+	sub := protected.PathPrefix("").Subrouter()
+	sub.Use(middleware.RequirePermission(permissions...))
+	return sub
+}
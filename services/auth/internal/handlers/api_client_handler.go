@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// APIClientHandler handles machine client HTTP requests
+type APIClientHandler struct {
+	apiClientService *service.APIClientService
+}
+
+// NewAPIClientHandler creates a new API client handler
+func NewAPIClientHandler(apiClientService *service.APIClientService) *APIClientHandler {
+	return &APIClientHandler{
+		apiClientService: apiClientService,
+	}
+}
+
+// ListAPIClients handles requests to list machine clients
+func (h *APIClientHandler) ListAPIClients(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	clients, err := h.apiClientService.List(r.Context(), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, clients)
+}
+
+// CreateAPIClient handles requests to register a machine client. The response
+// contains the API key, which is shown only once.
+func (h *APIClientHandler) CreateAPIClient(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.APIClientRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	client, err := h.apiClientService.Create(r.Context(), req, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, client)
+}
+
+// RotateAPIClientKey handles requests to replace the API key of a machine client
+func (h *APIClientHandler) RotateAPIClientKey(w http.ResponseWriter, r *http.Request) {
+	// Extract client ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	client, err := h.apiClientService.RotateKey(r.Context(), id, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, client)
+}
+
+// RevokeAPIClient handles requests to revoke a machine client
+func (h *APIClientHandler) RevokeAPIClient(w http.ResponseWriter, r *http.Request) {
+	// Extract client ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.apiClientService.Revoke(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
 	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
 	"github.com/ignaseim/bartenderapp/services/pkg/models"
 )
@@ -33,15 +38,81 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call service to authenticate user
-	resp, err := h.authService.Login(loginReq.Username, loginReq.Password)
+	resp, err := h.authService.Login(r.Context(), loginReq.Username, loginReq.Password, loginReq.DeviceName, middleware.ClientIP(r))
 	if err != nil {
-		middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithLoginError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// LoginMFA handles requests that exchange an MFA challenge token and a code for tokens
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Call service to check the second factor
+	resp, err := h.authService.CompleteMFALogin(r.Context(), req.MFAToken, req.Code, req.DeviceName, middleware.ClientIP(r))
+	if err != nil {
+		respondWithLoginError(w, err)
 		return
 	}
 
 	middleware.RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// LoginPasswordChange handles the new password of a user who must replace the
+// password they were given before the login completes
+func (h *AuthHandler) LoginPasswordChange(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordChangeLoginRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	resp, err := h.authService.CompletePasswordChange(r.Context(), req.PasswordChangeToken, req.NewPassword, req.DeviceName)
+	if err != nil {
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) || errors.Is(err, service.ErrSamePassword) {
+			respondWithPasswordError(w, err)
+			return
+		}
+		respondWithLoginError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// EnrollMFA handles TOTP enrollment during login for users who must enroll
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+	}
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	enrollment, err := h.authService.EnrollMFAForLogin(r.Context(), req.MFAToken)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, enrollment)
+}
+
 // RefreshToken handles token refresh requests
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -55,7 +126,7 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call service to refresh token
-	resp, err := h.authService.RefreshToken(req.RefreshToken)
+	resp, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
 		middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
@@ -64,8 +135,14 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	middleware.RespondWithJSON(w, http.StatusOK, resp)
 }
 
-// VerifyToken handles token verification requests
+// VerifyToken handles token verification requests.
+//
+// Deprecated: services should verify tokens with the JWKS or use /introspect.
 func (h *AuthHandler) VerifyToken(w http.ResponseWriter, r *http.Request) {
+	// Point callers to the replacement (RFC 8594)
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</introspect>; rel="successor-version"`)
+
 	var req struct {
 		Token string `json:"token"`
 	}
@@ -77,7 +154,7 @@ func (h *AuthHandler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call service to verify token
-	claims, err := h.authService.VerifyToken(req.Token)
+	claims, err := h.authService.VerifyToken(r.Context(), req.Token)
 	if err != nil {
 		middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
 		return
@@ -91,12 +168,104 @@ func (h *AuthHandler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 
 	// Create response
 	resp := map[string]interface{}{
-		"valid":      true,
-		"user_id":    claims.UserID,
-		"username":   claims.Username,
-		"role":       claims.Role,
-		"expires_at": expiresAt,
+		"valid":       true,
+		"user_id":     claims.UserID,
+		"username":    claims.Username,
+		"role":        claims.Role,
+		"permissions": claims.Permissions,
+		"expires_at":  expiresAt,
 	}
 
 	middleware.RespondWithJSON(w, http.StatusOK, resp)
-} 
\ No newline at end of file
+}
+
+// JWKS serves the public signing keys as a JSON Web Key Set
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	// Allow verifiers and proxies to cache the key set for a short while
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	middleware.RespondWithJSON(w, http.StatusOK, h.authService.JWKS())
+}
+
+// Logout handles requests to end the current session
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Revoke the token and its session
+	if err := h.authService.Logout(r.Context(), principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// RevokeAllSessions handles requests to revoke every session of a user
+func (h *AuthHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Revoke all sessions
+	if err := h.authService.RevokeAllSessions(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// UnlockUser handles requests to clear a user's login lockout
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Unlock user
+	if err := h.authService.UnlockUser(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// respondWithLoginError maps login errors to responses. Throttled attempts get
+// 429 with a Retry-After header, everything else 401.
+func respondWithLoginError(w http.ResponseWriter, err error) {
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		retryAfter := int(math.Ceil(blocked.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		middleware.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
+}
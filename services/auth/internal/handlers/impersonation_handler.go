@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// ImpersonationHandler handles requests to act as another user
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+}
+
+// NewImpersonationHandler creates a new impersonation handler
+func NewImpersonationHandler(impersonationService *service.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+	}
+}
+
+// Impersonate handles requests for a token to act as a user
+func (h *ImpersonationHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	resp, err := h.impersonationService.Impersonate(r.Context(), id, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// InvitationHandler handles user invitation HTTP requests
+type InvitationHandler struct {
+	invitationService *service.InvitationService
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitationService *service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+	}
+}
+
+// ListInvitations handles requests to list invitations
+func (h *InvitationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get status filter from query parameters
+	status := r.URL.Query().Get("status")
+
+	invitations, err := h.invitationService.List(r.Context(), status, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, invitations)
+}
+
+// CreateInvitation handles requests to invite a new user
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req models.InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	invitation, err := h.invitationService.Invite(r.Context(), req, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, invitation)
+}
+
+// ResendInvitation handles requests to send a new link for an open invitation
+func (h *InvitationHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	// Extract invitation ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	invitation, err := h.invitationService.Resend(r.Context(), id, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, invitation)
+}
+
+// RevokeInvitation handles requests to withdraw an invitation
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	// Extract invitation ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.invitationService.Revoke(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// AcceptInvitation handles requests of invitees to create their account
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	// Extract invite token from URL path
+	token := mux.Vars(r)["token"]
+
+	// Parse request body
+	var req models.AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := h.invitationService.Accept(r.Context(), token, req)
+	if err != nil {
+		respondWithPasswordError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, user)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// MFAHandler handles two-factor authentication HTTP requests
+type MFAHandler struct {
+	mfaService *service.MFAService
+}
+
+// NewMFAHandler creates a new MFA handler
+func NewMFAHandler(mfaService *service.MFAService) *MFAHandler {
+	return &MFAHandler{
+		mfaService: mfaService,
+	}
+}
+
+// mfaCodeRequest is the body of requests that need a current code
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Enroll handles requests to start TOTP enrollment for the current user
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), principal.UserID)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, enrollment)
+}
+
+// Confirm handles requests to confirm a pending TOTP enrollment
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	codes, err := h.mfaService.Confirm(r.Context(), principal.UserID, req.Code)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// Disable handles requests to turn off TOTP for the current user
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), principal.UserID, req.Code); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// RegenerateRecoveryCodes handles requests to replace the current user's recovery codes
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), principal.UserID, req.Code)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// Reset handles admin requests to remove another user's TOTP enrollment
+func (h *MFAHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.mfaService.Reset(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// OIDCHandler handles logins with external identity providers
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// ListProviders handles requests to list the identity providers users can log in with
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	middleware.RespondWithJSON(w, http.StatusOK, h.oidcService.Providers())
+}
+
+// Authorize handles requests to start a login with an identity provider
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	authorization, err := h.oidcService.Authorize(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		respondWithOIDCError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, authorization)
+}
+
+// Callback handles the code and state the identity provider redirected back
+// with and responds like a password login
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var req models.OIDCCallbackRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	resp, err := h.oidcService.Login(r.Context(), mux.Vars(r)["provider"], req)
+	if err != nil {
+		respondWithOIDCError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// ListMyIdentities handles requests to list the accounts linked to the current user
+func (h *OIDCHandler) ListMyIdentities(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	identities, err := h.oidcService.ListIdentities(r.Context(), principal.UserID, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, identities)
+}
+
+// AuthorizeLink handles requests to start linking an identity provider
+// account to the current user
+func (h *OIDCHandler) AuthorizeLink(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.OIDCLinkRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	authorization, err := h.oidcService.AuthorizeLink(r.Context(), mux.Vars(r)["provider"], req, middleware.ClientIP(r), principal.Claims)
+	if err != nil {
+		respondWithOIDCLinkError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, authorization)
+}
+
+// LinkIdentity handles the code and state the identity provider redirected
+// back with after AuthorizeLink and links the account to the current user
+func (h *OIDCHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	identity, err := h.oidcService.Link(r.Context(), mux.Vars(r)["provider"], req, principal.Claims)
+	if err != nil {
+		respondWithOIDCLinkError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, identity)
+}
+
+// ListIdentities handles requests to list the accounts linked to a user
+func (h *OIDCHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	identities, err := h.oidcService.ListIdentities(r.Context(), id, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, identities)
+}
+
+// UnlinkIdentity handles requests to unlink an account from a user
+func (h *OIDCHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	// Extract user and identity ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	identityID, err := strconv.Atoi(vars["identity_id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid identity ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.oidcService.Unlink(r.Context(), id, identityID, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// respondWithOIDCError maps external login errors to responses. Unknown
+// providers get 404, everything else 401 like failed password logins.
+func respondWithOIDCError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrUnknownOIDCProvider) {
+		middleware.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusUnauthorized, err.Error())
+}
+
+// respondWithOIDCLinkError maps link errors to responses. The caller is
+// logged in, so failures are 400 rather than 401.
+func respondWithOIDCLinkError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrUnknownOIDCProvider) {
+		middleware.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if errors.Is(err, service.ErrReauthenticationFailed) {
+		middleware.RespondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		respondWithLoginError(w, err)
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+}
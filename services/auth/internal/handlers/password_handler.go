@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// PasswordHandler handles password reset HTTP requests
+type PasswordHandler struct {
+	passwordResetService *service.PasswordResetService
+}
+
+// NewPasswordHandler creates a new password handler
+func NewPasswordHandler(passwordResetService *service.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{
+		passwordResetService: passwordResetService,
+	}
+}
+
+// ForgotPassword handles requests for a password reset link. The response is
+// the same whether or not the address belongs to an account.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.passwordResetService.Forgot(r.Context(), req.Email, middleware.ClientIP(r)); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If an account with this e-mail exists, a reset link has been sent",
+	})
+}
+
+// ResetPassword handles requests that set a new password with a reset token
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.passwordResetService.Reset(r.Context(), req.Token, req.NewPassword); err != nil {
+		respondWithPasswordError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// respondWithPasswordError reports password policy violations individually
+// with 422 so clients can show them next to the field, other errors with 400
+func respondWithPasswordError(w http.ResponseWriter, err error) {
+	var policyErr *service.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		middleware.RespondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":      policyErr.Error(),
+			"violations": policyErr.Violations,
+		})
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+}
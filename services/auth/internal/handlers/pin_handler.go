@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// TerminalKeyHeader carries the key of the terminal a PIN login is made on
+const TerminalKeyHeader = "X-Terminal-Key"
+
+// PINHandler handles PIN login and PIN management HTTP requests
+type PINHandler struct {
+	pinService *service.PINService
+}
+
+// NewPINHandler creates a new PIN handler
+func NewPINHandler(pinService *service.PINService) *PINHandler {
+	return &PINHandler{
+		pinService: pinService,
+	}
+}
+
+// Login handles PIN login requests from registered terminals
+func (h *PINHandler) Login(w http.ResponseWriter, r *http.Request) {
+	// Get terminal key from header
+	terminalKey := r.Header.Get(TerminalKeyHeader)
+	if terminalKey == "" {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Terminal key is required")
+		return
+	}
+
+	var req models.PINLoginRequest
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.UserID == 0 && req.Username == "" {
+		middleware.RespondWithError(w, http.StatusBadRequest, "User ID or username is required")
+		return
+	}
+
+	// Call service to authenticate user
+	resp, err := h.pinService.Login(r.Context(), terminalKey, req, middleware.ClientIP(r))
+	if err != nil {
+		respondWithLoginError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// SetPIN handles requests to set the PIN of the current user
+func (h *PINHandler) SetPIN(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		PIN             string `json:"pin"`
+	}
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.pinService.SetPIN(r.Context(), principal.Claims, req.CurrentPassword, req.PIN); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// RemovePIN handles requests to remove the PIN of the current user
+func (h *PINHandler) RemovePIN(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.pinService.RemovePIN(r.Context(), principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// SetUserPIN handles admin requests to set or remove the PIN of another user
+func (h *PINHandler) SetUserPIN(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.pinService.SetUserPIN(r.Context(), id, req.PIN, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// RoleHandler handles role and permission HTTP requests
+type RoleHandler struct {
+	roleService *service.RoleService
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roleService *service.RoleService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+	}
+}
+
+// ListRoles handles requests to list roles and their permissions
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Listing roles requires roles:manage or users:write
+	if !principal.HasPermission(auth.PermRolesManage, auth.PermUsersWrite) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires roles:manage or users:write permission")
+		return
+	}
+
+	roles, err := h.roleService.List(r.Context(), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, roles)
+}
+
+// CreateRole handles requests to create a role
+func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var role models.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.roleService.Create(r.Context(), &role, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, role)
+}
+
+// UpdateRole handles requests to change the description and permissions of a role
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var role models.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Set role name from URL
+	role.Name = mux.Vars(r)["name"]
+
+	if err := h.roleService.Update(r.Context(), &role, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, role)
+}
+
+// DeleteRole handles requests to delete a role
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.roleService.Delete(r.Context(), mux.Vars(r)["name"], principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// ListPermissions handles requests to list all permissions
+func (h *RoleHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Listing permissions requires roles:manage or api_clients:manage
+	if !principal.HasPermission(auth.PermRolesManage, auth.PermAPIClientsManage) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires roles:manage or api_clients:manage permission")
+		return
+	}
+
+	permissions, err := h.roleService.ListPermissions(r.Context(), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, permissions)
+}
+
+// CreatePermission handles requests to create a permission
+func (h *RoleHandler) CreatePermission(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var permission models.Permission
+	if err := json.NewDecoder(r.Body).Decode(&permission); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.roleService.CreatePermission(r.Context(), &permission, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, permission)
+}
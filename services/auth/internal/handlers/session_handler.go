@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// SessionHandler handles requests to list and sign out sessions
+type SessionHandler struct {
+	sessionService *service.SessionService
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *service.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+// ListMySessions handles requests to list the sessions of the current user
+func (h *SessionHandler) ListMySessions(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessions, err := h.sessionService.List(r.Context(), principal.UserID, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeMySession handles requests to sign out a session of the current user
+func (h *SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), principal.UserID, mux.Vars(r)["session_id"], principal.Claims); err != nil {
+		respondWithSessionError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// ListSessions handles requests to list the sessions of a user
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessions, err := h.sessionService.List(r.Context(), id, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession handles requests to sign out a session of a user
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	// Extract user and session ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), id, vars["session_id"], principal.Claims); err != nil {
+		respondWithSessionError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// respondWithSessionError maps session errors to responses. Unknown sessions
+// get 404, everything else 400.
+func respondWithSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrSessionNotFound) {
+		middleware.RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+}
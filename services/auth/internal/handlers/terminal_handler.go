@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// TerminalHandler handles terminal registration HTTP requests
+type TerminalHandler struct {
+	terminalService *service.TerminalService
+}
+
+// NewTerminalHandler creates a new terminal handler
+func NewTerminalHandler(terminalService *service.TerminalService) *TerminalHandler {
+	return &TerminalHandler{
+		terminalService: terminalService,
+	}
+}
+
+// ListTerminals handles requests to list registered terminals
+func (h *TerminalHandler) ListTerminals(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	terminals, err := h.terminalService.List(r.Context(), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, terminals)
+}
+
+// RegisterTerminal handles requests to register a new terminal. The response
+// contains the terminal key, which is shown only once.
+func (h *TerminalHandler) RegisterTerminal(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	// Parse request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	terminal, err := h.terminalService.Register(r.Context(), req.Name, principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, terminal)
+}
+
+// RevokeTerminal handles requests to revoke a terminal
+func (h *TerminalHandler) RevokeTerminal(w http.ResponseWriter, r *http.Request) {
+	// Extract terminal ID from URL path
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid terminal ID")
+		return
+	}
+
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.terminalService.Revoke(r.Context(), id, principal.Claims); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// TokenHandler handles the OAuth token and introspection endpoints
+type TokenHandler struct {
+	tokenService *service.TokenService
+}
+
+// NewTokenHandler creates a new token handler
+func NewTokenHandler(tokenService *service.TokenService) *TokenHandler {
+	return &TokenHandler{
+		tokenService: tokenService,
+	}
+}
+
+// IssueToken handles client credentials token requests. Clients authenticate
+// with HTTP Basic or client_id and client_secret form parameters (RFC 6749).
+func (h *TokenHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	// Parse form body
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: "invalid form body"})
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		respondWithOAuthError(w, &service.OAuthError{Code: service.OAuthUnsupportedGrantType, Description: "only client_credentials is supported"})
+		return
+	}
+
+	// Basic credentials are form-encoded before they are base64-encoded
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	resp, err := h.tokenService.ClientCredentials(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"), r.PostForm.Get("audience"))
+	if err != nil {
+		respondWithOAuthError(w, err)
+		return
+	}
+
+	// Token responses must not be cached (RFC 6749 section 5.1)
+	w.Header().Set("Cache-Control", "no-store")
+	middleware.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// Introspect handles token introspection requests (RFC 7662). The token is
+// sent as a form parameter; token_type_hint is accepted but not needed.
+func (h *TokenHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse form body
+	if err := r.ParseForm(); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid form body")
+		return
+	}
+
+	result, err := h.tokenService.Introspect(r.Context(), r.PostForm.Get("token"), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	middleware.RespondWithJSON(w, http.StatusOK, result)
+}
+
+// respondWithOAuthError sends an OAuth error response. Failed client
+// authentication gets 401 with a Basic challenge, all other errors 400.
+func respondWithOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == service.OAuthInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="bartenderapp"`)
+		status = http.StatusUnauthorized
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	middleware.RespondWithJSON(w, status, oauthErr)
+}
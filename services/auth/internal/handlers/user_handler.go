@@ -1,26 +1,40 @@
 package handlers
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/service"
 	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
 	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
 	"github.com/ignaseim/bartenderapp/services/pkg/models"
 )
 
+// maxImportSize bounds the size of CSV files for user imports
+const maxImportSize = 2 << 20
+
 // UserHandler handles user-related HTTP requests
 type UserHandler struct {
-	userService *service.UserService
+	userService       *service.UserService
+	userImportService *service.UserImportService
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(userService *service.UserService) *UserHandler {
+func NewUserHandler(userService *service.UserService, userImportService *service.UserImportService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:       userService,
+		userImportService: userImportService,
 	}
 }
 
@@ -34,21 +48,21 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Check if user is requesting their own data or is admin
-	if claims.UserID != id && claims.Role != "admin" {
-		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Can only view own user or must be admin")
+	// Check if user is requesting their own data or may view other users
+	if principal.UserID != id && !principal.HasPermission(auth.PermUsersRead) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Can only view own user or requires users:read permission")
 		return
 	}
 
 	// Get user
-	user, err := h.userService.GetByID(id)
+	user, err := h.userService.GetByID(r.Context(), id)
 	if err != nil {
 		middleware.RespondWithError(w, http.StatusNotFound, err.Error())
 		return
@@ -59,15 +73,15 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 // GetCurrentUser handles requests to get the current user
 func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Get current user
-	user, err := h.userService.GetCurrentUser(claims)
+	user, err := h.userService.GetCurrentUser(r.Context(), principal.Claims)
 	if err != nil {
 		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -76,59 +90,304 @@ func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	middleware.RespondWithJSON(w, http.StatusOK, user)
 }
 
+// ChangePassword handles requests of the current user to change their password
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.userService.ChangePassword(r.Context(), principal.Claims, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			middleware.RespondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		respondWithPasswordError(w, err)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// PasswordSchemeReport handles requests for the number of users per password hash scheme
+func (h *UserHandler) PasswordSchemeReport(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	report, err := h.userService.PasswordSchemeReport(r.Context(), principal.Claims)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, report)
+}
+
 // ListUsers handles requests to list all users
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Only admins can list all users
-	if claims.Role != "admin" {
-		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires admin role")
+	// Listing users requires users:read
+	if !principal.HasPermission(auth.PermUsersRead) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires users:read permission")
 		return
 	}
 
-	// Get role filter from query parameters
-	role := r.URL.Query().Get("role")
+	// Get filters, sorting and pagination from query parameters
+	q, err := parseUserListQuery(r.URL.Query())
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Get users
-	users, err := h.userService.List(role)
+	page, err := h.userService.List(r.Context(), q, r.URL.Query().Get("cursor"))
 	if err != nil {
-		middleware.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidUserFilter) {
+			middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logging.FromContext(r.Context()).Error("Error listing users", "error", err)
+		middleware.RespondWithError(w, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// ExportUsers handles requests to download the users matching the list
+// filters as CSV. Pagination parameters are ignored.
+func (h *UserHandler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Exporting users requires users:read
+	if !principal.HasPermission(auth.PermUsersRead) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires users:read permission")
+		return
+	}
+
+	// Get filters and sorting from query parameters
+	q, err := parseUserListQuery(r.URL.Query())
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	middleware.RespondWithJSON(w, http.StatusOK, users)
+	filename := fmt.Sprintf("users-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(service.UserCSVHeader)
+
+	err = h.userService.Export(r.Context(), q, func(user models.User) error {
+		return writer.Write(service.UserCSVRecord(user))
+	})
+	writer.Flush()
+
+	// The status is already sent, so a failure can only cut the export short
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error exporting users", "error", err)
+	}
+}
+
+// ImportUsers handles requests to create users from a CSV file, sent either
+// as the request body or as the file field of a multipart form. With
+// dry_run=true the rows are only checked.
+func (h *UserHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Importing users requires users:write
+	if !principal.HasPermission(auth.PermUsersWrite) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires users:write permission")
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, "Invalid dry_run, expected true or false")
+			return
+		}
+	}
+
+	// Read the CSV file from the body or a multipart form
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			respondWithImportError(w, err, "Missing CSV file in form field file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	result, err := h.userImportService.Import(r.Context(), body, dryRun, principal.Claims)
+	if err != nil {
+		if errors.Is(err, service.ErrImportRejected) {
+			middleware.RespondWithJSON(w, http.StatusUnprocessableEntity, result)
+			return
+		}
+		respondWithImportError(w, err, err.Error())
+		return
+	}
+
+	if dryRun {
+		middleware.RespondWithJSON(w, http.StatusOK, result)
+		return
+	}
+
+	middleware.RespondWithJSON(w, http.StatusCreated, result)
+}
+
+// respondWithImportError maps import errors to responses. Files over the
+// size limit get 413, everything else 400 with message.
+func respondWithImportError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		middleware.RespondWithError(w, http.StatusRequestEntityTooLarge, "CSV file is too large")
+		return
+	}
+
+	middleware.RespondWithError(w, http.StatusBadRequest, message)
+}
+
+// parseUserListQuery reads the query parameters of user lists. Dates are
+// either RFC 3339 timestamps or YYYY-MM-DD; created_to includes the whole day.
+func parseUserListQuery(values url.Values) (models.UserListQuery, error) {
+	q := models.UserListQuery{
+		Search: strings.TrimSpace(values.Get("search")),
+		Role:   values.Get("role"),
+		Status: values.Get("status"),
+		Sort:   values.Get("sort"),
+	}
+
+	if q.Status != "" && q.Status != models.UserStatusActive && q.Status != models.UserStatusDeactivated {
+		return q, errors.New("invalid status, expected active or deactivated")
+	}
+
+	switch q.Sort {
+	case "", "username", "email", "role", "created_at":
+	default:
+		return q, errors.New("invalid sort, expected username, email, role or created_at")
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("invalid order, expected asc or desc")
+	}
+
+	for name, target := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if value := values.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s", name)
+			}
+			*target = n
+		}
+	}
+
+	if value := values.Get("created_from"); value != "" {
+		from, _, err := parseDateParam(value)
+		if err != nil {
+			return q, errors.New("invalid created_from")
+		}
+		q.CreatedFrom = &from
+	}
+
+	if value := values.Get("created_to"); value != "" {
+		to, dateOnly, err := parseDateParam(value)
+		if err != nil {
+			return q, errors.New("invalid created_to")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		q.CreatedTo = &to
+	}
+
+	return q, nil
+}
+
+// parseDateParam parses an RFC 3339 timestamp or a YYYY-MM-DD date (UTC) and
+// reports whether it was a date
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
 }
 
 // CreateUser handles requests to create a new user
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Only admins can create users
-	if claims.Role != "admin" {
-		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires admin role")
+	// Creating users requires users:write
+	if !principal.HasPermission(auth.PermUsersWrite) {
+		middleware.RespondWithError(w, http.StatusForbidden, "Forbidden - Requires users:write permission")
 		return
 	}
 
-	// Parse request body
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	// Parse request body; the password is not part of the user JSON
+	var req struct {
+		models.User
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	user := req.User
+	user.PasswordHash = req.Password
 
 	// Create user
-	if err := h.userService.Create(&user, claims); err != nil {
-		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
+	if err := h.userService.Create(r.Context(), &user, principal.Claims); err != nil {
+		respondWithPasswordError(w, err)
 		return
 	}
 
@@ -145,25 +404,30 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Parse request body
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var req models.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		middleware.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	user := req.User
 
 	// Set user ID from URL
 	user.ID = id
 
 	// Update user
-	if err := h.userService.Update(&user, claims); err != nil {
+	if err := h.userService.Update(r.Context(), &user, req.CurrentPassword, principal.Claims); err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			middleware.RespondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -171,8 +435,25 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	middleware.RespondWithJSON(w, http.StatusOK, user)
 }
 
-// DeleteUser handles requests to delete a user
+// DeleteUser handles requests to delete a user. Users are deactivated rather
+// than removed; see EraseUser.
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUserState(w, r, h.userService.Deactivate)
+}
+
+// ReactivateUser handles requests to reactivate a deactivated user
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUserState(w, r, h.userService.Reactivate)
+}
+
+// EraseUser handles requests to permanently delete a deactivated user
+func (h *UserHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	h.changeUserState(w, r, h.userService.Erase)
+}
+
+// changeUserState runs an operation on the user in the URL path and responds
+// with 204 on success
+func (h *UserHandler) changeUserState(w http.ResponseWriter, r *http.Request, operation func(context.Context, int, *auth.Claims) error) {
 	// Extract user ID from URL path
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -181,18 +462,17 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get claims from context
-	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	// Get the caller from context
+	principal, ok := auth.FromContext(r.Context())
 	if !ok {
 		middleware.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Delete user
-	if err := h.userService.Delete(id, claims); err != nil {
+	if err := operation(r.Context(), id, principal.Claims); err != nil {
 		middleware.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	middleware.RespondWithJSON(w, http.StatusNoContent, nil)
-} 
\ No newline at end of file
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+	"github.com/lib/pq"
+)
+
+// APIClientRepository handles database operations for machine clients
+type APIClientRepository struct {
+	db *sql.DB
+}
+
+// NewAPIClientRepository creates a new APIClientRepository
+func NewAPIClientRepository(db *sql.DB) *APIClientRepository {
+	return &APIClientRepository{
+		db: db,
+	}
+}
+
+// GetByID retrieves a machine client by ID
+func (r *APIClientRepository) GetByID(ctx context.Context, id int) (*models.APIClient, error) {
+	query := `
+		SELECT client_id, name, scopes, audiences, key_prefix, key_hash, created_by, created_at, last_used_at, expires_at, revoked_at
+		FROM api_clients
+		WHERE client_id = $1
+	`
+
+	var client models.APIClient
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&client.ID,
+		&client.Name,
+		pq.Array(&client.Scopes),
+		pq.Array(&client.Audiences),
+		&client.KeyPrefix,
+		&client.KeyHash,
+		&client.CreatedBy,
+		&client.CreatedAt,
+		&client.LastUsedAt,
+		&client.ExpiresAt,
+		&client.RevokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("API client not found")
+		}
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// List retrieves all machine clients
+func (r *APIClientRepository) List(ctx context.Context) ([]models.APIClient, error) {
+	query := `
+		SELECT client_id, name, scopes, audiences, key_prefix, key_hash, created_by, created_at, last_used_at, expires_at, revoked_at
+		FROM api_clients
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []models.APIClient
+
+	for rows.Next() {
+		var client models.APIClient
+		if err := rows.Scan(
+			&client.ID,
+			&client.Name,
+			pq.Array(&client.Scopes),
+			pq.Array(&client.Audiences),
+			&client.KeyPrefix,
+			&client.KeyHash,
+			&client.CreatedBy,
+			&client.CreatedAt,
+			&client.LastUsedAt,
+			&client.ExpiresAt,
+			&client.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// Create registers a new machine client
+func (r *APIClientRepository) Create(ctx context.Context, client *models.APIClient) error {
+	query := `
+		INSERT INTO api_clients (name, scopes, audiences, key_prefix, key_hash, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING client_id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx,
+		query,
+		client.Name,
+		pq.Array(client.Scopes),
+		pq.Array(client.Audiences),
+		client.KeyPrefix,
+		client.KeyHash,
+		client.CreatedBy,
+		client.ExpiresAt,
+	).Scan(&client.ID, &client.CreatedAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating API client", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateKey replaces the API key of an active machine client
+func (r *APIClientRepository) UpdateKey(ctx context.Context, id int, keyPrefix, keyHash string) error {
+	query := `
+		UPDATE api_clients
+		SET key_prefix = $1, key_hash = $2, last_used_at = NULL
+		WHERE client_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, keyPrefix, keyHash, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating API key", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("API client not found")
+	}
+
+	return nil
+}
+
+// Revoke disables a machine client
+func (r *APIClientRepository) Revoke(ctx context.Context, id int) error {
+	query := `
+		UPDATE api_clients
+		SET revoked_at = NOW()
+		WHERE client_id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("API client not found")
+	}
+
+	return nil
+}
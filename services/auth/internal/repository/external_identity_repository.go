@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// ErrInvalidOIDCState is returned for unknown, used or expired login states
+var ErrInvalidOIDCState = errors.New("invalid or expired login state")
+
+// ExternalIdentityRepository handles database operations for accounts at
+// external identity providers and pending external logins
+type ExternalIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewExternalIdentityRepository creates a new ExternalIdentityRepository
+func NewExternalIdentityRepository(db *sql.DB) *ExternalIdentityRepository {
+	return &ExternalIdentityRepository{
+		db: db,
+	}
+}
+
+// GetBySubject retrieves the identity of a provider account
+func (r *ExternalIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	query := `
+		SELECT identity_id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM external_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	identity, err := scanExternalIdentity(r.db.QueryRowContext(ctx, query, provider, subject))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("external identity not found")
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// ListByUser retrieves the identities linked to a user
+func (r *ExternalIdentityRepository) ListByUser(ctx context.Context, userID int) ([]models.ExternalIdentity, error) {
+	query := `
+		SELECT identity_id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM external_identities
+		WHERE user_id = $1
+		ORDER BY provider, created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.ExternalIdentity{}
+	for rows.Next() {
+		identity, err := scanExternalIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// Create links a provider account to a user
+func (r *ExternalIdentityRepository) Create(ctx context.Context, identity *models.ExternalIdentity) error {
+	return insertExternalIdentity(ctx, r.db, identity)
+}
+
+// CreateWithUser creates a user and links a provider account to them in one
+// transaction, so no account is left behind that nobody can log in to
+func (r *ExternalIdentityRepository) CreateWithUser(ctx context.Context, user *models.User, identity *models.ExternalIdentity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	if err := insertExternalIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordLogin stores the time of a login with an identity and the e-mail
+// address the provider reported
+func (r *ExternalIdentityRepository) RecordLogin(ctx context.Context, id int, email string) error {
+	query := `
+		UPDATE external_identities
+		SET last_login_at = NOW(), email = COALESCE($2, email)
+		WHERE identity_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, nullString(email))
+	if err != nil {
+		logging.FromContext(ctx).Error("Error recording external login", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Delete unlinks an identity from a user
+func (r *ExternalIdentityRepository) Delete(ctx context.Context, userID, id int) error {
+	query := `
+		DELETE FROM external_identities
+		WHERE identity_id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error deleting external identity", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("external identity not found")
+	}
+
+	return nil
+}
+
+// CreateState stores a pending external login. Expired states are purged on
+// the way, since most of them belong to logins that were abandoned.
+func (r *ExternalIdentityRepository) CreateState(ctx context.Context, state *models.OIDCLoginState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		logging.FromContext(ctx).Error("Error purging OIDC login states", "error", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, expires_at, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt, state.LinkUserID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating OIDC login state", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeState removes and returns a pending external login that has not
+// expired. A state can only be consumed once.
+func (r *ExternalIdentityRepository) ConsumeState(ctx context.Context, stateHash string) (*models.OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING state_hash, provider, code_verifier, nonce, expires_at, user_id
+	`
+
+	var state models.OIDCLoginState
+	err := r.db.QueryRowContext(ctx, query, stateHash).Scan(
+		&state.StateHash,
+		&state.Provider,
+		&state.CodeVerifier,
+		&state.Nonce,
+		&state.ExpiresAt,
+		&state.LinkUserID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// insertExternalIdentity inserts an identity, either directly or inside a transaction
+func insertExternalIdentity(ctx context.Context, q rowQuerier, identity *models.ExternalIdentity) error {
+	query := `
+		INSERT INTO external_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING identity_id, created_at, last_login_at
+	`
+
+	err := q.QueryRowContext(ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		nullString(identity.Email),
+	).Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating external identity", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// scanExternalIdentity scans an external identity row
+func scanExternalIdentity(row rowScanner) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// ErrInvalidInvitation is returned for unknown, accepted, revoked or expired invite tokens
+var ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+// invitationColumns are selected by all invitation queries; the status is
+// derived from the timestamps
+const invitationColumns = `
+	invitation_id, email, role,
+	CASE
+		WHEN accepted_at IS NOT NULL THEN 'accepted'
+		WHEN revoked_at IS NOT NULL THEN 'revoked'
+		WHEN expires_at <= NOW() THEN 'expired'
+		ELSE 'pending'
+	END,
+	token_hash, invited_by, expires_at, sent_at, accepted_at, user_id, revoked_at, created_at
+`
+
+// InvitationRepository handles database operations for user invitations
+type InvitationRepository struct {
+	db *sql.DB
+}
+
+// NewInvitationRepository creates a new InvitationRepository
+func NewInvitationRepository(db *sql.DB) *InvitationRepository {
+	return &InvitationRepository{
+		db: db,
+	}
+}
+
+// GetByID retrieves an invitation by ID
+func (r *InvitationRepository) GetByID(ctx context.Context, id int) (*models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE invitation_id = $1`
+
+	invitation, err := scanInvitation(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// GetPendingByTokenHash retrieves the pending invitation an invite token belongs to
+func (r *InvitationRepository) GetPendingByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	invitation, err := scanInvitation(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// List retrieves invitations, newest first, optionally filtered by status
+func (r *InvitationRepository) List(ctx context.Context, status string) ([]models.Invitation, error) {
+	var filter string
+	switch status {
+	case "":
+	case models.InvitationPending:
+		filter = `WHERE accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()`
+	case models.InvitationAccepted:
+		filter = `WHERE accepted_at IS NOT NULL`
+	case models.InvitationRevoked:
+		filter = `WHERE accepted_at IS NULL AND revoked_at IS NOT NULL`
+	case models.InvitationExpired:
+		filter = `WHERE accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= NOW()`
+	default:
+		return nil, errors.New("invalid invitation status")
+	}
+
+	query := `SELECT ` + invitationColumns + ` FROM invitations ` + filter + ` ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Create stores a new invitation. It fails if the address already has an open invitation.
+func (r *InvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	return insertInvitation(ctx, r.db, invitation)
+}
+
+// HasOpen reports whether an address has an invitation that was neither
+// accepted nor revoked. Expired invitations count as open until revoked.
+func (r *InvitationRepository) HasOpen(ctx context.Context, email string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM invitations
+			WHERE LOWER(email) = LOWER($1) AND accepted_at IS NULL AND revoked_at IS NULL
+		)
+	`
+
+	var open bool
+	if err := r.db.QueryRowContext(ctx, query, email).Scan(&open); err != nil {
+		return false, err
+	}
+
+	return open, nil
+}
+
+// insertInvitation inserts an invitation, either directly or inside a transaction
+func insertInvitation(ctx context.Context, q rowQuerier, invitation *models.Invitation) error {
+	query := `
+		INSERT INTO invitations (email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING invitation_id, sent_at, created_at
+	`
+
+	err := q.QueryRowContext(ctx,
+		query,
+		invitation.Email,
+		invitation.Role,
+		invitation.TokenHash,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.SentAt, &invitation.CreatedAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating invitation", "error", err)
+		return err
+	}
+
+	invitation.Status = models.InvitationPending
+	return nil
+}
+
+// Renew replaces the token of an invitation that was neither accepted nor
+// revoked and extends its expiry. The previous token stops working.
+func (r *InvitationRepository) Renew(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE invitations
+		SET token_hash = $1, expires_at = $2, sent_at = NOW()
+		WHERE invitation_id = $3 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, tokenHash, expiresAt, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error renewing invitation", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("invitation not found or no longer open")
+	}
+
+	return nil
+}
+
+// Revoke withdraws an invitation that was not accepted yet
+func (r *InvitationRepository) Revoke(ctx context.Context, id int) error {
+	query := `
+		UPDATE invitations
+		SET revoked_at = NOW()
+		WHERE invitation_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("invitation not found or no longer open")
+	}
+
+	return nil
+}
+
+// Accept creates the user of a pending invitation and marks the invitation as
+// accepted in one transaction, so an invite token can be used only once
+func (r *InvitationRepository) Accept(ctx context.Context, tokenHash string, user *models.User) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var invitationID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT invitation_id
+		FROM invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, tokenHash).Scan(&invitationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidInvitation
+		}
+		return err
+	}
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE invitations
+		SET accepted_at = NOW(), user_id = $1
+		WHERE invitation_id = $2
+	`, user.ID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanInvitation scans a row selected with invitationColumns
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.Status,
+		&invitation.TokenHash,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.SentAt,
+		&invitation.AcceptedAt,
+		&invitation.UserID,
+		&invitation.RevokedAt,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
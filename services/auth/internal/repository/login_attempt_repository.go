@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// LoginAttemptRepository handles database operations for failed login tracking
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository creates a new LoginAttemptRepository
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{
+		db: db,
+	}
+}
+
+// Get retrieves the failed login state for a scope and key. It returns nil
+// without an error when there are no recorded failures.
+func (r *LoginAttemptRepository) Get(ctx context.Context, scope, key string) (*models.LoginAttempt, error) {
+	query := `
+		SELECT scope, attempt_key, failures, last_failed_at, locked_until
+		FROM login_attempts
+		WHERE scope = $1 AND attempt_key = $2
+	`
+
+	var attempt models.LoginAttempt
+	err := r.db.QueryRowContext(ctx, query, scope, key).Scan(
+		&attempt.Scope,
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailedAt,
+		&attempt.LockedUntil,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// Reserve counts an attempt for a scope and key as failed before it is
+// checked, so that concurrent attempts cannot all pass before the first
+// failure is recorded. The row is locked while check decides on the state
+// before the attempt; if it returns an error nothing is counted. The count
+// restarts at one when the previous failure is older than window or an earlier
+// lock has expired.
+func (r *LoginAttemptRepository) Reserve(ctx context.Context, scope, key string, window time.Duration, check func(*models.LoginAttempt) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Create the row first so that the first attempts are serialized as well
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_attempts (scope, attempt_key, failures, last_failed_at)
+		VALUES ($1, $2, 0, NOW())
+		ON CONFLICT (scope, attempt_key) DO NOTHING
+	`, scope, key)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT scope, attempt_key, failures, last_failed_at, locked_until
+		FROM login_attempts
+		WHERE scope = $1 AND attempt_key = $2
+		FOR UPDATE
+	`
+
+	var attempt models.LoginAttempt
+	err = tx.QueryRowContext(ctx, query, scope, key).Scan(
+		&attempt.Scope,
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailedAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := check(&attempt); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE login_attempts
+		SET failures = CASE
+				WHEN last_failed_at < NOW() - make_interval(secs => $3)
+					OR locked_until <= NOW() THEN 1
+				ELSE failures + 1
+			END,
+			locked_until = CASE
+				WHEN locked_until <= NOW() THEN NULL
+				ELSE locked_until
+			END,
+			last_failed_at = NOW()
+		WHERE scope = $1 AND attempt_key = $2
+	`, scope, key, window.Seconds())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Release takes back a reserved attempt that did not fail
+func (r *LoginAttemptRepository) Release(ctx context.Context, scope, key string) error {
+	query := `
+		UPDATE login_attempts
+		SET failures = GREATEST(failures - 1, 0)
+		WHERE scope = $1 AND attempt_key = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// Lock locks a scope and key until the given time
+func (r *LoginAttemptRepository) Lock(ctx context.Context, scope, key string, until time.Time) error {
+	query := `
+		UPDATE login_attempts
+		SET locked_until = $3
+		WHERE scope = $1 AND attempt_key = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key, until)
+	return err
+}
+
+// Reset clears all failures and any lock for a scope and key
+func (r *LoginAttemptRepository) Reset(ctx context.Context, scope, key string) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE scope = $1 AND attempt_key = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// PurgeExpired removes the failures of all scopes and keys whose last failure
+// is older than window and that are not locked. Usernames that do not exist
+// are only removed this way.
+func (r *LoginAttemptRepository) PurgeExpired(ctx context.Context, window time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failed_at < NOW() - make_interval(secs => $1)
+			AND (locked_until IS NULL OR locked_until <= NOW())
+	`
+
+	result, err := r.db.ExecContext(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
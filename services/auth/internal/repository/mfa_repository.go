@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// MFARepository handles database operations for two-factor authentication
+type MFARepository struct {
+	db *sql.DB
+}
+
+// NewMFARepository creates a new MFARepository
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{
+		db: db,
+	}
+}
+
+// GetByUserID retrieves the TOTP enrollment of a user. It returns nil without
+// an error when the user has not started enrollment.
+func (r *MFARepository) GetByUserID(ctx context.Context, userID int) (*models.UserMFA, error) {
+	query := `
+		SELECT user_id, totp_secret, enabled_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	var mfa models.UserMFA
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.TOTPSecret,
+		&mfa.EnabledAt,
+		&mfa.LastUsedStep,
+		&mfa.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SavePending stores a new, not yet confirmed TOTP secret for a user,
+// replacing any previous pending secret
+func (r *MFARepository) SavePending(ctx context.Context, userID int, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, enabled_at = NULL, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error saving TOTP secret", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+// Enable confirms the pending TOTP secret and replaces the recovery codes
+func (r *MFARepository) Enable(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_mfa
+		SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records the time step of an accepted code. It returns false if the
+// step, or a later one, was already used, which means the code is a replay.
+func (r *MFARepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns false if
+// no such unused code exists.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReplaceRecoveryCodes discards all recovery codes of a user and stores new ones
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the TOTP enrollment and recovery codes of a user
+func (r *MFARepository) Delete(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes swaps the recovery codes of a user inside a transaction
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO mfa_recovery_codes (user_id, code_hash)
+			VALUES ($1, $2)
+		`, userID, hash)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error storing recovery code", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordResetRepository handles database operations for password reset tokens
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+// NewPasswordResetRepository creates a new PasswordResetRepository
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: db,
+	}
+}
+
+// Create stores a new reset token and invalidates all earlier unused tokens
+// of the user, so only the most recent link works
+func (r *PasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := invalidateResetTokens(ctx, tx, token.UserID); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, requested_ip)
+		VALUES ($1, $2, $3, $4)
+		RETURNING token_id, created_at
+	`, token.UserID, token.TokenHash, token.ExpiresAt, token.RequestedIP).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating password reset token", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LastRequestedAt returns when the most recent reset token of a user was
+// created, or nil if there is none
+func (r *PasswordResetRepository) LastRequestedAt(ctx context.Context, userID int) (*time.Time, error) {
+	query := `
+		SELECT MAX(created_at)
+		FROM password_reset_tokens
+		WHERE user_id = $1
+	`
+
+	var createdAt *time.Time
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&createdAt); err != nil {
+		return nil, err
+	}
+
+	return createdAt, nil
+}
+
+// GetUserID returns the user a valid, unused reset token belongs to
+func (r *PasswordResetRepository) GetUserID(ctx context.Context, tokenHash string) (int, error) {
+	query := `
+		SELECT user_id
+		FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+	`
+
+	var userID int
+	if err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword marks a valid token as used and sets the new password hash of
+// its user in one transaction. It returns the ID of the user.
+func (r *PasswordResetRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	if err := setPasswordHash(ctx, tx, userID, passwordHash); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// invalidateResetTokens marks all unused reset tokens of a user as used
+func invalidateResetTokens(ctx context.Context, tx *sql.Tx, userID int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	return err
+}
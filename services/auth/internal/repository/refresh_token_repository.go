@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that has already been
+// rotated or revoked is presented again
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+// RefreshTokenRepository handles database operations for refresh tokens
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+// NewRefreshTokenRepository creates a new RefreshTokenRepository
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db: db,
+	}
+}
+
+// GetByHash retrieves a refresh token by the hash of its value
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT token_id, user_id, family_id, token_hash, expires_at, rotated_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+
+	var token models.RefreshToken
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.RotatedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("refresh token not found")
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Create stores a new refresh token. If FamilyID is empty a new family is started.
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, COALESCE(NULLIF($2, '')::uuid, uuid_generate_v4()), $3, $4)
+		RETURNING token_id, family_id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx,
+		query,
+		token.UserID,
+		token.FamilyID,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.FamilyID, &token.CreatedAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating refresh token", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Rotate marks the token with the given ID as rotated and stores its
+// replacement in the same transaction. ErrRefreshTokenReused is returned if the
+// old token was already rotated or revoked, e.g. by a concurrent request.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, oldID int, next *models.RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET rotated_at = NOW()
+		WHERE token_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`, oldID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING token_id, created_at
+	`,
+		next.UserID,
+		next.FamilyID,
+		next.TokenHash,
+		next.ExpiresAt,
+	).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error rotating refresh token", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeFamily revokes every token that belongs to the given family
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// RevokeAllForUser revokes every refresh token that belongs to a user
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
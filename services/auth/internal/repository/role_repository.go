@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+	"github.com/lib/pq"
+)
+
+// RoleRepository handles database operations for roles and permissions
+type RoleRepository struct {
+	db *sql.DB
+}
+
+// NewRoleRepository creates a new RoleRepository
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{
+		db: db,
+	}
+}
+
+// GetByName retrieves a role and its permissions
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	query := `
+		SELECT r.role_name, r.description, r.is_system, r.created_at,
+			COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.role_name
+		WHERE r.role_name = $1
+		GROUP BY r.role_name
+	`
+
+	var role models.Role
+	err := r.db.QueryRowContext(ctx, query, name).Scan(
+		&role.Name,
+		&role.Description,
+		&role.System,
+		&role.CreatedAt,
+		pq.Array(&role.Permissions),
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("role not found")
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// List retrieves all roles and their permissions
+func (r *RoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	query := `
+		SELECT r.role_name, r.description, r.is_system, r.created_at,
+			COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.role_name
+		GROUP BY r.role_name
+		ORDER BY r.role_name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(
+			&role.Name,
+			&role.Description,
+			&role.System,
+			&role.CreatedAt,
+			pq.Array(&role.Permissions),
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetPermissions retrieves the permissions granted to a role
+func (r *RoleRepository) GetPermissions(ctx context.Context, roleName string) ([]string, error) {
+	query := `
+		SELECT permission_name
+		FROM role_permissions
+		WHERE role_name = $1
+		ORDER BY permission_name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Create adds a new role with its permissions
+func (r *RoleRepository) Create(ctx context.Context, role *models.Role) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO roles (role_name, description)
+		VALUES ($1, $2)
+		RETURNING is_system, created_at
+	`, role.Name, role.Description).Scan(&role.System, &role.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating role", "error", err)
+		return err
+	}
+
+	if err := replaceRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update changes the description of a role and replaces its permissions
+func (r *RoleRepository) Update(ctx context.Context, role *models.Role) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE roles
+		SET description = $1
+		WHERE role_name = $2
+	`, role.Description, role.Name)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating role", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("role not found")
+	}
+
+	if err := replaceRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a role that is not a system role and not assigned to any user
+func (r *RoleRepository) Delete(ctx context.Context, name string) error {
+	query := `
+		DELETE FROM roles
+		WHERE role_name = $1
+			AND NOT is_system
+			AND NOT EXISTS (SELECT 1 FROM users WHERE role = $1)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("role not found, is a system role or is still assigned to users")
+	}
+
+	return nil
+}
+
+// ListPermissions retrieves all permissions
+func (r *RoleRepository) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	query := `
+		SELECT permission_name, description
+		FROM permissions
+		ORDER BY permission_name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []models.Permission
+
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// CreatePermission adds a new permission
+func (r *RoleRepository) CreatePermission(ctx context.Context, permission *models.Permission) error {
+	query := `
+		INSERT INTO permissions (permission_name, description)
+		VALUES ($1, $2)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, permission.Name, permission.Description); err != nil {
+		logging.FromContext(ctx).Error("Error creating permission", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// UnknownPermissions returns the names that do not exist as permissions
+func (r *RoleRepository) UnknownPermissions(ctx context.Context, names []string) ([]string, error) {
+	query := `
+		SELECT name
+		FROM unnest($1::text[]) AS name
+		WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE permission_name = name)
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unknown []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
+
+// replaceRolePermissions swaps the permissions of a role inside a transaction
+func replaceRolePermissions(ctx context.Context, tx *sql.Tx, roleName string, permissions []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_name = $1`, roleName); err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role_name, permission_name)
+			VALUES ($1, $2)
+		`, roleName, permission)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error granting permission", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+	"github.com/lib/pq"
+)
+
+// ErrSessionNotFound is returned for sessions that do not exist, belong to
+// another user or have already ended
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository handles database operations for sessions
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new SessionRepository
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// Create stores a new session. Its ID must be the family ID of its refresh tokens.
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (session_id, user_id, device_name, ip, user_agent, auth_methods)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at, last_seen_at
+	`
+
+	err := r.db.QueryRowContext(ctx,
+		query,
+		session.ID,
+		session.UserID,
+		nullString(session.DeviceName),
+		nullString(session.IP),
+		nullString(session.UserAgent),
+		pq.Array(session.AuthMethods),
+	).Scan(&session.CreatedAt, &session.LastSeenAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating session", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Touch records that a session was used again, e.g. to refresh its tokens.
+// The IP and user agent are updated since devices move between networks.
+func (r *SessionRepository) Touch(ctx context.Context, id, ip, userAgent string) error {
+	query := `
+		UPDATE sessions
+		SET last_seen_at = NOW(), ip = COALESCE($2, ip), user_agent = COALESCE($3, user_agent)
+		WHERE session_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, nullString(ip), nullString(userAgent))
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating session", "error", err)
+	}
+	return err
+}
+
+// GetAuthMethods retrieves the authentication methods a session was started
+// with, so tokens refreshed in the session keep their amr claim
+func (r *SessionRepository) GetAuthMethods(ctx context.Context, id string) ([]string, error) {
+	query := `
+		SELECT auth_methods
+		FROM sessions
+		WHERE session_id = $1 AND revoked_at IS NULL
+	`
+
+	var authMethods []string
+	err := r.db.QueryRowContext(ctx, query, id).Scan(pq.Array(&authMethods))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return authMethods, nil
+}
+
+// ListByUser retrieves the sessions of a user that still have a usable
+// refresh token, most recently used first
+func (r *SessionRepository) ListByUser(ctx context.Context, userID int) ([]models.Session, error) {
+	query := `
+		SELECT s.session_id, s.user_id, COALESCE(s.device_name, ''), COALESCE(s.ip, ''),
+			COALESCE(s.user_agent, ''), s.auth_methods, s.created_at, s.last_seen_at, MAX(t.expires_at)
+		FROM sessions s
+		JOIN refresh_tokens t ON t.family_id = s.session_id
+			AND t.revoked_at IS NULL AND t.rotated_at IS NULL AND t.expires_at > NOW()
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL
+		GROUP BY s.session_id
+		ORDER BY s.last_seen_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.DeviceName,
+			&session.IP,
+			&session.UserAgent,
+			pq.Array(&session.AuthMethods),
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke ends a session of a user and revokes its refresh tokens. Its access
+// tokens are rejected by the denylist from then on.
+func (r *SessionRepository) Revoke(ctx context.Context, userID int, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE session_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error revoking session", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error revoking session tokens", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
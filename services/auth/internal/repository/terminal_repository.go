@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// TerminalRepository handles database operations for POS terminals
+type TerminalRepository struct {
+	db *sql.DB
+}
+
+// NewTerminalRepository creates a new TerminalRepository
+func NewTerminalRepository(db *sql.DB) *TerminalRepository {
+	return &TerminalRepository{
+		db: db,
+	}
+}
+
+// GetByKeyPrefix retrieves a terminal by the public prefix of its key
+func (r *TerminalRepository) GetByKeyPrefix(ctx context.Context, prefix string) (*models.Terminal, error) {
+	query := `
+		SELECT terminal_id, name, key_prefix, key_hash, created_by, created_at, last_seen_at, revoked_at
+		FROM terminals
+		WHERE key_prefix = $1
+	`
+
+	var terminal models.Terminal
+	err := r.db.QueryRowContext(ctx, query, prefix).Scan(
+		&terminal.ID,
+		&terminal.Name,
+		&terminal.KeyPrefix,
+		&terminal.KeyHash,
+		&terminal.CreatedBy,
+		&terminal.CreatedAt,
+		&terminal.LastSeenAt,
+		&terminal.RevokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("terminal not found")
+		}
+		return nil, err
+	}
+
+	return &terminal, nil
+}
+
+// List retrieves all terminals
+func (r *TerminalRepository) List(ctx context.Context) ([]models.Terminal, error) {
+	query := `
+		SELECT terminal_id, name, key_prefix, key_hash, created_by, created_at, last_seen_at, revoked_at
+		FROM terminals
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var terminals []models.Terminal
+
+	for rows.Next() {
+		var terminal models.Terminal
+		if err := rows.Scan(
+			&terminal.ID,
+			&terminal.Name,
+			&terminal.KeyPrefix,
+			&terminal.KeyHash,
+			&terminal.CreatedBy,
+			&terminal.CreatedAt,
+			&terminal.LastSeenAt,
+			&terminal.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		terminals = append(terminals, terminal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return terminals, nil
+}
+
+// Create registers a new terminal
+func (r *TerminalRepository) Create(ctx context.Context, terminal *models.Terminal) error {
+	query := `
+		INSERT INTO terminals (name, key_prefix, key_hash, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING terminal_id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx,
+		query,
+		terminal.Name,
+		terminal.KeyPrefix,
+		terminal.KeyHash,
+		terminal.CreatedBy,
+	).Scan(&terminal.ID, &terminal.CreatedAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error creating terminal", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// TouchLastSeen records that a terminal was just used
+func (r *TerminalRepository) TouchLastSeen(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE terminals SET last_seen_at = NOW() WHERE terminal_id = $1`, id)
+	return err
+}
+
+// Revoke disables a terminal
+func (r *TerminalRepository) Revoke(ctx context.Context, id int) error {
+	query := `
+		UPDATE terminals
+		SET revoked_at = NOW()
+		WHERE terminal_id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("terminal not found")
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"fmt"
+	"strings"
 
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
 	"github.com/ignaseim/bartenderapp/services/pkg/models"
 )
 
@@ -21,15 +24,15 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
-		SELECT user_id, username, email, password_hash, role, created_at, updated_at
+		SELECT user_id, username, email, password_hash, role, created_at, updated_at, active, deactivated_at, password_change_required
 		FROM users
 		WHERE user_id = $1
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -37,6 +40,9 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Active,
+		&user.DeactivatedAt,
+		&user.PasswordChangeRequired,
 	)
 
 	if err != nil {
@@ -50,15 +56,15 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 }
 
 // GetByUsername retrieves a user by username
-func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT user_id, username, email, password_hash, role, created_at, updated_at
+		SELECT user_id, username, email, password_hash, role, created_at, updated_at, active, deactivated_at, password_change_required
 		FROM users
 		WHERE username = $1
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, username).Scan(
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -66,6 +72,9 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Active,
+		&user.DeactivatedAt,
+		&user.PasswordChangeRequired,
 	)
 
 	if err != nil {
@@ -78,35 +87,101 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
-// List retrieves all users, optionally filtered by role
-func (r *UserRepository) List(role string) ([]models.User, error) {
-	var query string
-	var rows *sql.Rows
-	var err error
+// GetByEmail retrieves a user by e-mail address, ignoring case
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `
+		SELECT user_id, username, email, password_hash, role, created_at, updated_at, active, deactivated_at, password_change_required
+		FROM users
+		WHERE LOWER(email) = LOWER($1)
+	`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Active,
+		&user.DeactivatedAt,
+		&user.PasswordChangeRequired,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ErrInvalidUserFilter is returned for user list queries with an unknown
+// sort field or status
+var ErrInvalidUserFilter = errors.New("invalid user filter")
+
+// userSortColumns maps the sort keys of user lists to columns
+var userSortColumns = map[string]string{
+	"username":   "username",
+	"email":      "email",
+	"role":       "role",
+	"created_at": "created_at",
+}
+
+// List retrieves one page of users matching a query. Password hashes are not
+// selected.
+func (r *UserRepository) List(ctx context.Context, q models.UserListQuery) ([]models.User, error) {
+	conditions, args, err := userListConditions(q)
+	if err != nil {
+		return nil, err
+	}
+
+	column, ok := userSortColumns[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid sort field", ErrInvalidUserFilter)
+	}
+
+	direction, comparison := "ASC", ">"
+	if q.Desc {
+		direction, comparison = "DESC", "<"
+	}
 
-	if role != "" {
-		query = `
-			SELECT user_id, username, email, password_hash, role, created_at, updated_at
-			FROM users
-			WHERE role = $1
-			ORDER BY username
-		`
-		rows, err = r.db.Query(query, role)
-	} else {
-		query = `
-			SELECT user_id, username, email, password_hash, role, created_at, updated_at
-			FROM users
-			ORDER BY username
-		`
-		rows, err = r.db.Query(query)
+	// Keyset pagination continues after the last user of the previous page
+	if q.After != nil {
+		cast := ""
+		if column == "created_at" {
+			cast = "::timestamptz"
+		}
+		args = append(args, q.After.Value, q.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, user_id) %s ($%d%s, $%d)", column, comparison, len(args)-1, cast, len(args)))
 	}
 
+	query := `
+		SELECT user_id, username, email, role, created_at, updated_at, active, deactivated_at, password_change_required
+		FROM users
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, user_id %s", column, direction, direction)
+
+	args = append(args, q.Limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+	if q.After == nil && q.Offset > 0 {
+		args = append(args, q.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []models.User
+	users := []models.User{}
 
 	for rows.Next() {
 		var user models.User
@@ -114,10 +189,12 @@ func (r *UserRepository) List(role string) ([]models.User, error) {
 			&user.ID,
 			&user.Username,
 			&user.Email,
-			&user.PasswordHash,
 			&user.Role,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.Active,
+			&user.DeactivatedAt,
+			&user.PasswordChangeRequired,
 		); err != nil {
 			return nil, err
 		}
@@ -131,24 +208,120 @@ func (r *UserRepository) List(role string) ([]models.User, error) {
 	return users, nil
 }
 
+// Count returns the number of users matching the filters of a query,
+// ignoring its pagination
+func (r *UserRepository) Count(ctx context.Context, q models.UserListQuery) (int, error) {
+	conditions, args, err := userListConditions(q)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `SELECT COUNT(*) FROM users`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// userListConditions builds the WHERE conditions for the filters of a user list query
+func userListConditions(q models.UserListQuery) ([]string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	if q.Search != "" {
+		// Treat % and _ in the search term literally
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q.Search) + "%"
+		args = append(args, pattern)
+		conditions = append(conditions, fmt.Sprintf("(username ILIKE $%d OR email ILIKE $%d)", len(args), len(args)))
+	}
+
+	if q.Role != "" {
+		args = append(args, q.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	switch q.Status {
+	case "":
+	case models.UserStatusActive:
+		conditions = append(conditions, "active")
+	case models.UserStatusDeactivated:
+		conditions = append(conditions, "NOT active")
+	default:
+		return nil, nil, fmt.Errorf("%w: invalid user status", ErrInvalidUserFilter)
+	}
+
+	if q.CreatedFrom != nil {
+		args = append(args, *q.CreatedFrom)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	if q.CreatedTo != nil {
+		args = append(args, *q.CreatedTo)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	return conditions, args, nil
+}
+
 // Create adds a new user
-func (r *UserRepository) Create(user *models.User) error {
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	return insertUser(ctx, r.db, user)
+}
+
+// Import creates users and invitations in one transaction, so either all
+// rows of an import are stored or none
+func (r *UserRepository) Import(ctx context.Context, users []*models.User, invitations []*models.Invitation) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, user := range users {
+		if err := insertUser(ctx, tx, user); err != nil {
+			return err
+		}
+	}
+
+	for _, invitation := range invitations {
+		if err := insertInvitation(ctx, tx, invitation); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertUser inserts a user, either directly or inside a transaction
+func insertUser(ctx context.Context, q rowQuerier, user *models.User) error {
 	query := `
-		INSERT INTO users (username, email, password_hash, role)
-		VALUES ($1, $2, $3, $4)
-		RETURNING user_id, created_at, updated_at
+		INSERT INTO users (username, email, password_hash, role, password_change_required)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING user_id, created_at, updated_at, active
 	`
 
-	err := r.db.QueryRow(
+	err := q.QueryRowContext(ctx,
 		query,
 		user.Username,
 		user.Email,
 		user.PasswordHash,
 		user.Role,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		user.PasswordChangeRequired,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Active)
 
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
+		logging.FromContext(ctx).Error("Error creating user", "error", err)
 		return err
 	}
 
@@ -156,64 +329,137 @@ func (r *UserRepository) Create(user *models.User) error {
 }
 
 // Update updates an existing user
-func (r *UserRepository) Update(user *models.User) error {
+func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	// Check if user exists
-	_, err := r.GetByID(user.ID)
+	existingUser, err := r.GetByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Passwords are changed through UpdatePassword
+	query := `
+		UPDATE users
+		SET username = $1, email = $2, role = $3, updated_at = NOW()
+		WHERE user_id = $4
+		RETURNING updated_at
+	`
+
+	err = tx.QueryRowContext(ctx,
+		query,
+		user.Username,
+		user.Email,
+		user.Role,
+		user.ID,
+	).Scan(&user.UpdatedAt)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating user", "error", err)
+		return err
+	}
+
+	// Reset links were sent to the old address and must not work anymore
+	if !strings.EqualFold(existingUser.Email, user.Email) {
+		if err := invalidateResetTokens(ctx, tx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete permanently removes a user. Orders and inventory transactions of the
+// user lose the reference to them.
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	query := `
+		DELETE FROM users
+		WHERE user_id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	// If password is being updated
-	if user.PasswordHash != "" {
-		query := `
-			UPDATE users
-			SET username = $1, email = $2, password_hash = $3, role = $4, updated_at = NOW()
-			WHERE user_id = $5
-			RETURNING updated_at
-		`
+	if rowsAffected == 0 {
+		return errors.New("user not found")
+	}
 
-		err = r.db.QueryRow(
-			query,
-			user.Username,
-			user.Email,
-			user.PasswordHash,
-			user.Role,
-			user.ID,
-		).Scan(&user.UpdatedAt)
-	} else {
-		// If password is not being updated
-		query := `
-			UPDATE users
-			SET username = $1, email = $2, role = $3, updated_at = NOW()
-			WHERE user_id = $4
-			RETURNING updated_at
-		`
+	return nil
+} 
+
+// SetActive deactivates or reactivates a user. It fails if the user is
+// already in the requested state.
+func (r *UserRepository) SetActive(ctx context.Context, id int, active bool) error {
+	query := `
+		UPDATE users
+		SET active = $2,
+			deactivated_at = CASE WHEN $2 THEN NULL ELSE NOW() END,
+			updated_at = NOW()
+		WHERE user_id = $1 AND active <> $2
+	`
 
-		err = r.db.QueryRow(
-			query,
-			user.Username,
-			user.Email,
-			user.Role,
-			user.ID,
-		).Scan(&user.UpdatedAt)
+	result, err := r.db.ExecContext(ctx, query, id, active)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating user status", "error", err)
+		return err
 	}
 
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error updating user: %v", err)
 		return err
 	}
 
+	if rowsAffected == 0 {
+		if active {
+			return errors.New("user not found or already active")
+		}
+		return errors.New("user not found or already deactivated")
+	}
+
 	return nil
 }
 
-// Delete removes a user
-func (r *UserRepository) Delete(id int) error {
+// GetPINHash retrieves the PIN hash of a user. It returns an empty string if
+// the user has no PIN.
+func (r *UserRepository) GetPINHash(ctx context.Context, id int) (string, error) {
 	query := `
-		DELETE FROM users
+		SELECT COALESCE(pin_hash, '')
+		FROM users
 		WHERE user_id = $1
 	`
 
-	result, err := r.db.Exec(query, id)
+	var pinHash string
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&pinHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errors.New("user not found")
+		}
+		return "", err
+	}
+
+	return pinHash, nil
+}
+
+// SetPINHash stores the PIN hash of a user. An empty hash removes the PIN.
+func (r *UserRepository) SetPINHash(ctx context.Context, id int, pinHash string) error {
+	query := `
+		UPDATE users
+		SET pin_hash = NULLIF($1, ''), updated_at = NOW()
+		WHERE user_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, pinHash, id)
 	if err != nil {
 		return err
 	}
@@ -228,4 +474,153 @@ func (r *UserRepository) Delete(id int) error {
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// UpdatePassword sets a new password hash and keeps the previous one in the
+// password history
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPasswordHash(ctx, tx, id, passwordHash); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RehashPassword replaces a password hash with a hash of the same password in
+// another scheme. Nothing is changed if the password was changed meanwhile.
+func (r *UserRepository) RehashPassword(ctx context.Context, id int, oldHash, newHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $3
+		WHERE user_id = $1 AND password_hash = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, oldHash, newHash)
+	return err
+}
+
+// CountPasswordHashFormats counts users by the header of their password hash,
+// which identifies the scheme and its parameters, e.g. "$2a$10$"
+func (r *UserRepository) CountPasswordHashFormats(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT
+			CASE
+				WHEN password_hash LIKE '$argon2id$%'
+					THEN '$argon2id$' || split_part(password_hash, '$', 3) || '$' || split_part(password_hash, '$', 4) || '$'
+				WHEN password_hash LIKE '$2_$%'
+					THEN '$' || split_part(password_hash, '$', 2) || '$' || split_part(password_hash, '$', 3) || '$'
+				ELSE ''
+			END AS format,
+			COUNT(*)
+		FROM users
+		GROUP BY format
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var format string
+		var count int
+		if err := rows.Scan(&format, &count); err != nil {
+			return nil, err
+		}
+		counts[format] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// GetPasswordHistory retrieves the most recent previous password hashes of a user
+func (r *UserRepository) GetPasswordHistory(ctx context.Context, id int, limit int) ([]string, error) {
+	query := `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC, history_id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// passwordHistoryLimit is the number of previous hashes kept per user
+const passwordHistoryLimit = 24
+
+// setPasswordHash moves the current password hash of a user into the history
+// and stores the new one inside a transaction. A password the user sets
+// themselves no longer needs to be changed.
+func setPasswordHash(ctx context.Context, tx *sql.Tx, userID int, passwordHash string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO password_history (user_id, password_hash)
+		SELECT user_id, password_hash FROM users WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET password_hash = $1, password_change_required = false, updated_at = NOW()
+		WHERE user_id = $2
+	`, passwordHash, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating password", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("user not found")
+	}
+
+	// Only keep the most recent entries
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND history_id NOT IN (
+			SELECT history_id FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC, history_id DESC
+			LIMIT $2
+		)
+	`, userID, passwordHistoryLimit)
+	return err
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// audiencePattern matches the names of services tokens can be issued for
+var audiencePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// APIClientService manages machine clients and their API keys
+type APIClientService struct {
+	apiClientRepo *repository.APIClientRepository
+	roleRepo      *repository.RoleRepository
+}
+
+// NewAPIClientService creates a new API client service
+func NewAPIClientService(apiClientRepo *repository.APIClientRepository, roleRepo *repository.RoleRepository) *APIClientService {
+	return &APIClientService{
+		apiClientRepo: apiClientRepo,
+		roleRepo:      roleRepo,
+	}
+}
+
+// List retrieves all machine clients
+func (s *APIClientService) List(ctx context.Context, claims *auth.Claims) ([]models.APIClient, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAPIClientsManage) {
+		return nil, errors.New("missing permission to list API clients")
+	}
+
+	return s.apiClientRepo.List(ctx)
+}
+
+// Create registers a new machine client. The returned client carries its API
+// key, which is not stored and cannot be retrieved again.
+func (s *APIClientService) Create(ctx context.Context, req models.APIClientRequest, claims *auth.Claims) (*models.APIClient, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAPIClientsManage) {
+		return nil, errors.New("missing permission to create API clients")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("client name is required")
+	}
+
+	// Scopes are permissions; nobody can grant a client more than they have
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	scopes, err := validatePermissions(ctx, s.roleRepo, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canGrant(claims, scopes) {
+		return nil, errors.New("missing permissions to grant these scopes")
+	}
+
+	audiences, err := normalizeAudiences(req.Audiences)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("expiry must be in the future")
+	}
+
+	key, prefix, hash, err := auth.NewSecretKey(auth.APIKeyKind)
+	if err != nil {
+		return nil, err
+	}
+
+	createdBy := claims.UserID
+	client := &models.APIClient{
+		Name:      name,
+		Scopes:    scopes,
+		Audiences: audiences,
+		KeyPrefix: prefix,
+		KeyHash:   hash,
+		CreatedBy: &createdBy,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := s.apiClientRepo.Create(ctx, client); err != nil {
+		return nil, err
+	}
+
+	client.Key = key
+	return client, nil
+}
+
+// RotateKey issues a new API key for a client. The previous key stops working immediately.
+func (s *APIClientService) RotateKey(ctx context.Context, id int, claims *auth.Claims) (*models.APIClient, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAPIClientsManage) {
+		return nil, errors.New("missing permission to rotate API keys")
+	}
+
+	key, prefix, hash, err := auth.NewSecretKey(auth.APIKeyKind)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apiClientRepo.UpdateKey(ctx, id, prefix, hash); err != nil {
+		return nil, err
+	}
+
+	client, err := s.apiClientRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Key = key
+	return client, nil
+}
+
+// Revoke disables a machine client and its API key
+func (s *APIClientService) Revoke(ctx context.Context, id int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAPIClientsManage) {
+		return errors.New("missing permission to revoke API clients")
+	}
+
+	return s.apiClientRepo.Revoke(ctx, id)
+}
+
+// normalizeAudiences lowercases and deduplicates the services a client may
+// request tokens for. Audiences are service names such as "inventory".
+func normalizeAudiences(audiences []string) ([]string, error) {
+	seen := make(map[string]bool, len(audiences))
+	normalized := make([]string, 0, len(audiences))
+	for _, audience := range audiences {
+		audience = strings.ToLower(strings.TrimSpace(audience))
+		if !audiencePattern.MatchString(audience) {
+			return nil, fmt.Errorf("invalid audience %q", audience)
+		}
+		if !seen[audience] {
+			seen[audience] = true
+			normalized = append(normalized, audience)
+		}
+	}
+	return normalized, nil
+}
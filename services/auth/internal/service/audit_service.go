@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+)
+
+// Page sizes of audit event lists
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// AuditService gives access to the audit log
+type AuditService struct {
+	store *audit.SQLRecorder
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(store *audit.SQLRecorder) *AuditService {
+	return &AuditService{
+		store: store,
+	}
+}
+
+// List retrieves one page of audit events matching a filter, newest first
+func (s *AuditService) List(ctx context.Context, filter audit.Filter, claims *auth.Claims) (*audit.Page, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAuditRead) {
+		return nil, errors.New("missing permission to read the audit log")
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+
+	total, err := s.store.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &audit.Page{
+		Events: events,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+// Export calls fn for every audit event matching a filter, newest first. A
+// zero filter.Limit exports all of them.
+func (s *AuditService) Export(ctx context.Context, filter audit.Filter, claims *auth.Claims, fn func(audit.Event) error) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermAuditRead) {
+		return errors.New("missing permission to read the audit log")
+	}
+
+	return s.store.Each(ctx, filter, fn)
+}
@@ -1,198 +1,670 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
-	"strings"
+	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
 	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/metrics"
 	"github.com/ignaseim/bartenderapp/services/pkg/models"
-	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// refreshTokenTTL is how long a refresh token stays valid after it is issued
+	refreshTokenTTL = 7 * 24 * time.Hour
+
+	// mfaChallengeTTL is how long a user has to enter the second factor
+	mfaChallengeTTL = 5 * time.Minute
+
+	// passwordChangeTTL is how long a user has to replace a password chosen by an admin
+	passwordChangeTTL = 10 * time.Minute
+)
+
+// errAccountDeactivated is returned when a deactivated user tries to log in
+var errAccountDeactivated = errors.New("account is deactivated")
+
+// ErrSamePassword is returned when a required password change keeps the password
+var ErrSamePassword = errors.New("choose a password other than the one you were given")
+
+// ErrReauthenticationFailed is returned when a logged in user does not confirm
+// a sensitive change with their password or a current code
+var ErrReauthenticationFailed = errors.New("current password or code is incorrect")
+
 // AuthService handles authentication operations
 type AuthService struct {
-	userRepo *repository.UserRepository
+	userRepo         *repository.UserRepository
+	roleRepo         *repository.RoleRepository
+	refreshTokenRepo *repository.RefreshTokenRepository
+	sessionRepo      *repository.SessionRepository
+	denylist         *auth.SQLDenylist
+	signer           *auth.Signer
+	loginGuard       *LoginGuard
+	mfaService       *MFAService
+	passwordPolicy   PasswordPolicy
+	recorder         audit.Recorder
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo *repository.UserRepository) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, refreshTokenRepo *repository.RefreshTokenRepository, sessionRepo *repository.SessionRepository, denylist *auth.SQLDenylist, signer *auth.Signer, loginGuard *LoginGuard, mfaService *MFAService, passwordPolicy PasswordPolicy, recorder audit.Recorder) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		sessionRepo:      sessionRepo,
+		denylist:         denylist,
+		signer:           signer,
+		loginGuard:       loginGuard,
+		mfaService:       mfaService,
+		passwordPolicy:   passwordPolicy,
+		recorder:         recorder,
 	}
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(username, password string) (*models.LoginResponse, error) {
+// Login authenticates a user and returns a JWT token. Repeated failures for
+// the same username or client IP are delayed and eventually locked out. Users
+// with two-factor authentication enabled, or whose role requires it, get an
+// MFA challenge token instead that must be exchanged via CompleteMFALogin.
+// Users who must replace their password get a password change token for
+// CompletePasswordChange. The device name labels the new session.
+func (s *AuthService) Login(ctx context.Context, username, password, deviceName, clientIP string) (*models.LoginResponse, error) {
+	// Refuse attempts while the username or client IP is throttled
+	if err := s.loginGuard.Reserve(ctx, username, clientIP); err != nil {
+		return nil, err
+	}
+
 	// Find user by username
-	user, err := s.userRepo.GetByUsername(username)
+	user, err := s.userRepo.GetByUsername(ctx, username)
 	if err != nil {
+		s.loginGuard.RecordFailure(ctx, username, clientIP)
+		s.recordLoginFailure(ctx, metrics.LoginPassword, username, nil)
 		return nil, errors.New("invalid credentials")
 	}
 
 	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
+	if !CheckPassword(user.PasswordHash, password) {
+		s.loginGuard.RecordFailure(ctx, username, clientIP)
+		s.recordLoginFailure(ctx, metrics.LoginPassword, username, user)
 		return nil, errors.New("invalid credentials")
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(*user)
+	// Deactivated users cannot log in
+	if !user.Active {
+		s.loginGuard.Release(ctx, username, clientIP)
+		s.recordLoginFailure(ctx, metrics.LoginPassword, username, user)
+		return nil, errAccountDeactivated
+	}
+
+	// Upgrade hashes of older schemes or parameters while the password is known
+	s.rehashPassword(ctx, user, password)
+
+	// Require a second factor before issuing tokens. Failures are only cleared
+	// once it has been checked, so MFA codes are rate limited as well.
+	mfaEnabled, err := s.mfaService.Enabled(ctx, user.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, fmt.Errorf("failed to check two-factor authentication: %w", err)
 	}
 
-	// Generate refresh token (simplified for example)
-	refreshToken, err := generateRefreshToken(*user)
+	if mfaEnabled || s.mfaService.Required(user) {
+		s.loginGuard.Release(ctx, username, clientIP)
+		return s.newMFAChallenge(user, []string{"pwd"}, !mfaEnabled)
+	}
+
+	s.loginGuard.RecordSuccess(ctx, username, clientIP)
+
+	if user.PasswordChangeRequired {
+		return s.newPasswordChangeChallenge(user, []string{"pwd"})
+	}
+
+	metrics.LoginSucceeded(metrics.LoginPassword)
+
+	return s.startSession(ctx, user, []string{"pwd"}, deviceName)
+}
+
+// CompleteMFALogin exchanges an MFA challenge token and a TOTP or recovery code
+// for tokens. If the user still had to enroll, the code confirms the pending
+// enrollment and the response contains the new recovery codes.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, mfaToken, code, deviceName, clientIP string) (*models.LoginResponse, error) {
+	claims, err := auth.ValidateTokenUse(ctx, mfaToken, auth.TokenUseMFAChallenge)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, errors.New("invalid or expired MFA token")
 	}
 
-	// Create response
-	response := &models.LoginResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		User: models.User{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		},
+	// Refuse attempts while the username or client IP is throttled
+	if err := s.loginGuard.Reserve(ctx, claims.Username, clientIP); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		s.loginGuard.Release(ctx, claims.Username, clientIP)
+		return nil, errors.New("user not found")
+	}
+
+	if !user.Active {
+		s.loginGuard.Release(ctx, claims.Username, clientIP)
+		return nil, errAccountDeactivated
+	}
+
+	mfaEnabled, err := s.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+
+	var recoveryCodes []string
+	if mfaEnabled {
+		err = s.mfaService.Verify(ctx, user.ID, code)
+	} else {
+		recoveryCodes, err = s.mfaService.Confirm(ctx, user.ID, code)
+	}
+	if err != nil {
+		s.loginGuard.RecordFailure(ctx, claims.Username, clientIP)
+		s.recordLoginFailure(ctx, metrics.LoginMFA, claims.Username, user)
+		return nil, err
+	}
+
+	// Challenge tokens are single use
+	if err := s.denylist.RevokeToken(ctx, claims); err != nil {
+		return nil, fmt.Errorf("failed to revoke MFA token: %w", err)
+	}
+
+	s.loginGuard.RecordSuccess(ctx, claims.Username, clientIP)
+
+	// The challenge names the first factor: a password or an external login
+	authMethods := []string{"pwd"}
+	if len(claims.AuthMethods) > 0 {
+		authMethods = append([]string{}, claims.AuthMethods...)
+	}
+	authMethods = append(authMethods, "otp")
+
+	// A password chosen by an admin is replaced before the login completes;
+	// only password logins are held up by it
+	var resp *models.LoginResponse
+	if user.PasswordChangeRequired && authMethods[0] == "pwd" {
+		resp, err = s.newPasswordChangeChallenge(user, authMethods)
+	} else {
+		metrics.LoginSucceeded(metrics.LoginMFA)
+		resp, err = s.startSession(ctx, user, authMethods, deviceName)
+	}
+	if err != nil {
+		return nil, err
 	}
+	resp.RecoveryCodes = recoveryCodes
 
-	return response, nil
+	return resp, nil
 }
 
-// RefreshToken generates a new JWT token from a refresh token
-func (s *AuthService) RefreshToken(refreshToken string) (*models.LoginResponse, error) {
-	// Validate refresh token
-	claims, err := validateRefreshToken(refreshToken)
+// CompletePasswordChange exchanges a password change token and a new password
+// for tokens. The new password must satisfy the password policy and differ
+// from the one the user was given.
+func (s *AuthService) CompletePasswordChange(ctx context.Context, token, newPassword, deviceName string) (*models.LoginResponse, error) {
+	claims, err := auth.ValidateTokenUse(ctx, token, auth.TokenUsePasswordChange)
 	if err != nil {
+		return nil, errors.New("invalid or expired password change token")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !user.Active {
+		return nil, errAccountDeactivated
+	}
+	if !user.PasswordChangeRequired {
+		return nil, errors.New("invalid or expired password change token")
+	}
+
+	if CheckPassword(user.PasswordHash, newPassword) {
+		return nil, ErrSamePassword
+	}
+	if err := s.passwordPolicy.checkNewPassword(ctx, s.userRepo, user, newPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
 		return nil, err
 	}
+	user.PasswordChangeRequired = false
+
+	// Password change tokens are single use
+	if err := s.denylist.RevokeToken(ctx, claims); err != nil {
+		return nil, fmt.Errorf("failed to revoke password change token: %w", err)
+	}
+
+	audit.Record(ctx, s.recorder, nil, audit.Event{
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+		Action:     audit.ActionPasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	metrics.LoginSucceeded(metrics.LoginPassword)
+
+	return s.startSession(ctx, user, claims.AuthMethods, deviceName)
+}
+
+// EnrollMFAForLogin starts TOTP enrollment for a user whose role requires two-factor
+// authentication but who has not enrolled yet, using the MFA challenge token
+func (s *AuthService) EnrollMFAForLogin(ctx context.Context, mfaToken string) (*models.MFAEnrollment, error) {
+	claims, err := auth.ValidateTokenUse(ctx, mfaToken, auth.TokenUseMFAChallenge)
+	if err != nil {
+		return nil, errors.New("invalid or expired MFA token")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if !s.mfaService.Required(user) {
+		return nil, errors.New("two-factor enrollment is not required for this user")
+	}
+
+	return s.mfaService.Enroll(ctx, user.ID)
+}
+
+// RefreshToken exchanges a refresh token for a new JWT token and a new refresh
+// token. The presented refresh token is rotated and cannot be used again; if it
+// is presented a second time the whole token family is revoked.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*models.LoginResponse, error) {
+	// Look up the stored token
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, errors.New("refresh token revoked")
+	}
+
+	// A rotated token must never be seen again. If it is, assume it was stolen
+	// and revoke every token descended from the same login.
+	if stored.RotatedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, errors.New("refresh token expired")
+	}
 
 	// Get user from database
-	user, err := s.userRepo.GetByID(claims.UserID)
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
+	// Deactivation revokes refresh tokens, but check in case one slipped through
+	if !user.Active {
+		return nil, errAccountDeactivated
+	}
+
+	// Load the current permissions of the role so that changes apply on refresh
+	permissions, err := s.roleRepo.GetPermissions(ctx, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	// Keep the methods the session was started with, so a session that passed
+	// MFA still shows it after a refresh. Sessions of older tokens have none.
+	authMethods, err := s.sessionRepo.GetAuthMethods(ctx, stored.FamilyID)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
 	// Generate new JWT token
-	token, err := auth.GenerateToken(*user)
+	token, err := s.signer.GenerateToken(*user, auth.TokenOptions{
+		SessionID:   stored.FamilyID,
+		AuthMethods: authMethods,
+		Permissions: permissions,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	// Generate new refresh token
-	newRefreshToken, err := generateRefreshToken(*user)
+	// Generate new refresh token in the same family
+	newRefreshToken, record, err := newRefreshToken(user.ID, stored.FamilyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	// Create response
-	response := &models.LoginResponse{
-		Token:        token,
-		RefreshToken: newRefreshToken,
-		User: models.User{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		},
+	if err := s.refreshTokenRepo.Rotate(ctx, stored.ID, record); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			return nil, s.handleRefreshTokenReuse(ctx, stored)
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
 	}
 
-	return response, nil
+	// Failing to record the use only makes the session look older
+	info := audit.RequestInfoFromContext(ctx)
+	_ = s.sessionRepo.Touch(ctx, stored.FamilyID, info.IP, info.UserAgent)
+
+	return newLoginResponse(user, token, newRefreshToken), nil
 }
 
 // VerifyToken verifies if a JWT token is valid
-func (s *AuthService) VerifyToken(tokenString string) (*auth.Claims, error) {
-	return auth.ValidateToken(tokenString)
-}
-
-// HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
-}
-
-// generateRefreshToken creates a refresh token for a user
-func generateRefreshToken(user models.User) (string, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
-	}
-
-	// Append "_refresh" to make it different from the access token secret
-	refreshSecret := secretKey + "_refresh"
-
-	// Create claims with a longer expiration (e.g., 7 days)
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
-	claims := &auth.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "bartenderapp",
-			Subject:   fmt.Sprintf("%d", user.ID),
-		},
+func (s *AuthService) VerifyToken(ctx context.Context, tokenString string) (*auth.Claims, error) {
+	return auth.ValidateToken(ctx, tokenString)
+}
+
+// JWKS returns the public keys that verify the tokens issued by this service
+func (s *AuthService) JWKS() auth.JWKS {
+	return s.signer.JWKS()
+}
+
+// Logout ends the session of the given access token. The token itself is
+// denylisted and the refresh tokens of its session are revoked.
+func (s *AuthService) Logout(ctx context.Context, claims *auth.Claims) error {
+	if err := s.denylist.RevokeToken(ctx, claims); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if claims.SessionID != "" {
+		if err := s.refreshTokenRepo.RevokeFamily(ctx, claims.SessionID); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(refreshSecret))
-	if err != nil {
-		return "", err
+		// End the session so that access tokens refreshed earlier are rejected too
+		if err := s.sessionRepo.Revoke(ctx, claims.UserID, claims.SessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
 	}
 
-	return tokenString, nil
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionLogout,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(claims.UserID),
+	})
+
+	return nil
 }
 
-// validateRefreshToken validates a refresh token and returns the claims
-func validateRefreshToken(tokenString string) (*auth.Claims, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return nil, errors.New("JWT_SECRET environment variable is not set")
+// RevokeAllSessions revokes every access and refresh token of a user
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to revoke sessions")
+	}
+
+	// Make sure the user exists
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.revokeTokens(ctx, userID); err != nil {
+		return err
 	}
 
-	// Append "_refresh" to make it different from the access token secret
-	refreshSecret := secretKey + "_refresh"
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionSessionsRevoked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(userID),
+	})
+
+	return nil
+}
+
+// Reauthenticate checks the current password of a logged in user, or a TOTP
+// or recovery code if they have two-factor authentication, before a sensitive
+// change. Failures count like failed logins.
+func (s *AuthService) Reauthenticate(ctx context.Context, user *models.User, password, code, clientIP string) error {
+	if err := s.loginGuard.Reserve(ctx, user.Username, clientIP); err != nil {
+		return err
+	}
 
-	// Parse the token
-	claims := &auth.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if code != "" {
+		mfaEnabled, err := s.mfaService.Enabled(ctx, user.ID)
+		if err != nil {
+			s.loginGuard.Release(ctx, user.Username, clientIP)
+			return fmt.Errorf("failed to check two-factor authentication: %w", err)
 		}
-		return []byte(refreshSecret), nil
+		if !mfaEnabled || s.mfaService.Verify(ctx, user.ID, code) != nil {
+			s.loginGuard.RecordFailure(ctx, user.Username, clientIP)
+			return ErrReauthenticationFailed
+		}
+	} else if !CheckPassword(user.PasswordHash, password) {
+		s.loginGuard.RecordFailure(ctx, user.Username, clientIP)
+		return ErrReauthenticationFailed
+	}
+
+	s.loginGuard.RecordSuccess(ctx, user.Username, clientIP)
+	return nil
+}
+
+// revokeTokens revokes every access and refresh token of a user
+func (s *AuthService) revokeTokens(ctx context.Context, userID int) error {
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := s.denylist.RevokeUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// UnlockUser clears failed logins and any lockout of a user
+func (s *AuthService) UnlockUser(ctx context.Context, userID int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to unlock users")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.loginGuard.Unlock(ctx, user.Username); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionUserUnlocked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(userID),
 	})
 
+	return nil
+}
+
+// recordLoginFailure audits and counts a failed login attempt with the given
+// method. The user is nil if the username does not exist.
+func (s *AuthService) recordLoginFailure(ctx context.Context, method, username string, user *models.User) {
+	metrics.LoginFailed(method)
+
+	event := audit.Event{
+		ActorName:  username,
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+	}
+	if user != nil {
+		event.ActorID = &user.ID
+		event.TargetID = strconv.Itoa(user.ID)
+	}
+
+	audit.Record(ctx, s.recorder, nil, event)
+}
+
+// rehashPassword replaces an outdated password hash with one of the current
+// scheme. Failures are only logged since the login itself succeeded.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	if !passwordHasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	hash, err := HashPassword(password)
 	if err != nil {
-		if strings.Contains(err.Error(), "token is expired") {
-			return nil, errors.New("refresh token expired")
-		}
-		return nil, err
+		logging.FromContext(ctx).Error("Error rehashing password", "error", err)
+		return
 	}
 
-	if !token.Valid {
-		return nil, errors.New("invalid refresh token")
+	if err := s.userRepo.RehashPassword(ctx, user.ID, user.PasswordHash, hash); err != nil {
+		logging.FromContext(ctx).Error("Error storing rehashed password", "error", err)
+		return
 	}
+	user.PasswordHash = hash
+}
+
+// handleRefreshTokenReuse revokes the family of a refresh token that was
+// presented after it had already been rotated
+func (s *AuthService) handleRefreshTokenReuse(ctx context.Context, token *models.RefreshToken) error {
+	logging.FromContext(ctx).Warn("Refresh token reuse detected", "user_id", token.UserID, "family_id", token.FamilyID)
 
-	return claims, nil
-} 
\ No newline at end of file
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	// The thief may hold access tokens of the session as well
+	if err := s.sessionRepo.Revoke(ctx, token.UserID, token.FamilyID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return errors.New("refresh token reuse detected")
+}
+
+// startSession starts a new refresh token family for a user, records it as a
+// session on the device the request came from and issues the first token pair
+func (s *AuthService) startSession(ctx context.Context, user *models.User, authMethods []string, deviceName string) (*models.LoginResponse, error) {
+	permissions, err := s.roleRepo.GetPermissions(ctx, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	refreshToken, record, err := newRefreshToken(user.ID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	if err := s.refreshTokenRepo.Create(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	info := audit.RequestInfoFromContext(ctx)
+	session := &models.Session{
+		ID:          record.FamilyID,
+		UserID:      user.ID,
+		DeviceName:  sessionDeviceName(deviceName, info.UserAgent),
+		IP:          info.IP,
+		UserAgent:   info.UserAgent,
+		AuthMethods: authMethods,
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+
+	// Generate JWT token bound to the new session
+	token, err := s.signer.GenerateToken(*user, auth.TokenOptions{
+		SessionID:   record.FamilyID,
+		AuthMethods: authMethods,
+		Permissions: permissions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	audit.Record(ctx, s.recorder, nil, audit.Event{
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
+	return newLoginResponse(user, token, refreshToken), nil
+}
+
+// newMFAChallenge issues a short-lived token that proves the first factor was
+// correct and can only be exchanged for real tokens together with a code
+func (s *AuthService) newMFAChallenge(user *models.User, authMethods []string, enrollmentRequired bool) (*models.LoginResponse, error) {
+	challenge, err := s.signer.GenerateToken(*user, auth.TokenOptions{
+		Use:         auth.TokenUseMFAChallenge,
+		AuthMethods: authMethods,
+		TTL:         mfaChallengeTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+	}
+
+	resp := newLoginResponse(user, "", "")
+	resp.MFARequired = true
+	resp.MFAToken = challenge
+	resp.MFAEnrollmentRequired = enrollmentRequired
+
+	return resp, nil
+}
+
+// newPasswordChangeChallenge issues a short-lived token that proves the user
+// logged in and can only be exchanged for real tokens with a new password
+func (s *AuthService) newPasswordChangeChallenge(user *models.User, authMethods []string) (*models.LoginResponse, error) {
+	challenge, err := s.signer.GenerateToken(*user, auth.TokenOptions{
+		Use:         auth.TokenUsePasswordChange,
+		AuthMethods: authMethods,
+		TTL:         passwordChangeTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password change token: %w", err)
+	}
+
+	resp := newLoginResponse(user, "", "")
+	resp.PasswordChangeRequired = true
+	resp.PasswordChangeToken = challenge
+
+	return resp, nil
+}
+
+// newLoginResponse builds the response returned after a successful login or refresh
+func newLoginResponse(user *models.User, token, refreshToken string) *models.LoginResponse {
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User: models.User{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	}
+}
+
+// newRefreshToken creates an opaque refresh token for a user. It returns the raw
+// token for the client and the record to store. An empty familyID starts a new family.
+func newRefreshToken(userID int, familyID string) (string, *models.RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	record := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+
+	return token, record, nil
+}
+
+// hashRefreshToken returns the hex-encoded SHA-256 hash of a refresh token
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
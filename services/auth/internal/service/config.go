@@ -0,0 +1,25 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// envInt reads an integer environment variable or returns a default value
+func envInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// envDuration reads a duration environment variable (e.g. "15m") or returns a default value
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/mailer"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// InvitationPolicy configures user invitations
+type InvitationPolicy struct {
+	// TokenTTL is how long an invitation link stays valid
+	TokenTTL time.Duration
+	// AcceptURL is the frontend page the link points to; the token is added as a query parameter
+	AcceptURL string
+}
+
+// InvitationPolicyFromEnv builds an InvitationPolicy from environment variables
+func InvitationPolicyFromEnv() InvitationPolicy {
+	acceptURL := os.Getenv("INVITATION_URL")
+	if acceptURL == "" {
+		acceptURL = "http://localhost:3000/accept-invitation"
+	}
+
+	return InvitationPolicy{
+		TokenTTL:  envDuration("INVITATION_TTL", 72*time.Hour),
+		AcceptURL: acceptURL,
+	}
+}
+
+// InvitationService handles invitations of new users
+type InvitationService struct {
+	invitationRepo *repository.InvitationRepository
+	userRepo       *repository.UserRepository
+	userService    *UserService
+	mailer         mailer.Mailer
+	policy         InvitationPolicy
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(invitationRepo *repository.InvitationRepository, userRepo *repository.UserRepository, userService *UserService, m mailer.Mailer, policy InvitationPolicy) *InvitationService {
+	return &InvitationService{
+		invitationRepo: invitationRepo,
+		userRepo:       userRepo,
+		userService:    userService,
+		mailer:         m,
+		policy:         policy,
+	}
+}
+
+// List returns invitations, optionally filtered by status
+func (s *InvitationService) List(ctx context.Context, status string, claims *auth.Claims) ([]models.Invitation, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return nil, errors.New("missing permission to manage invitations")
+	}
+
+	return s.invitationRepo.List(ctx, status)
+}
+
+// Invite e-mails an invitation link for an account with the given role. The
+// role must not grant anything the inviting user does not have.
+func (s *InvitationService) Invite(ctx context.Context, req models.InvitationRequest, claims *auth.Claims) (*models.Invitation, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return nil, errors.New("missing permission to invite users")
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if !strings.Contains(email, "@") {
+		return nil, errors.New("invalid email format")
+	}
+
+	if err := s.userService.checkAssignableRole(ctx, req.Role, claims); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		return nil, errors.New("a user with this email already exists")
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite token: %w", err)
+	}
+
+	invitedBy := claims.UserID
+	invitation := &models.Invitation{
+		Email:     email,
+		Role:      req.Role,
+		TokenHash: auth.HashSecretKey(token),
+		InvitedBy: &invitedBy,
+		ExpiresAt: time.Now().Add(s.policy.TokenTTL),
+	}
+	if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, errors.New("failed to create invitation, the address may already be invited")
+	}
+
+	s.send(ctx, invitation, token, claims.Username)
+
+	return invitation, nil
+}
+
+// Resend issues a new link for an open invitation and extends its expiry.
+// Links sent earlier stop working.
+func (s *InvitationService) Resend(ctx context.Context, id int, claims *auth.Claims) (*models.Invitation, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return nil, errors.New("missing permission to manage invitations")
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite token: %w", err)
+	}
+
+	if err := s.invitationRepo.Renew(ctx, id, auth.HashSecretKey(token), time.Now().Add(s.policy.TokenTTL)); err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.invitationRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.send(ctx, invitation, token, claims.Username)
+
+	return invitation, nil
+}
+
+// Revoke withdraws an invitation that was not accepted yet
+func (s *InvitationService) Revoke(ctx context.Context, id int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return errors.New("missing permission to manage invitations")
+	}
+
+	return s.invitationRepo.Revoke(ctx, id)
+}
+
+// Accept creates the account of an invitee with the username and password
+// they chose. The user gets the e-mail address and role of the invitation and
+// is subject to the same rules as users created by an admin.
+func (s *InvitationService) Accept(ctx context.Context, token string, req models.AcceptInvitationRequest) (*models.User, error) {
+	if token == "" {
+		return nil, repository.ErrInvalidInvitation
+	}
+
+	tokenHash := auth.HashSecretKey(token)
+
+	invitation, err := s.invitationRepo.GetPendingByTokenHash(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	user := &models.User{
+		Username:     username,
+		Email:        invitation.Email,
+		Role:         invitation.Role,
+		PasswordHash: req.Password,
+	}
+
+	err = s.userService.create(ctx, user, nil, func(ctx context.Context, user *models.User) error {
+		return s.invitationRepo.Accept(ctx, tokenHash, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// send e-mails the invitation link. Failures are only logged so that the
+// invitation can be resent.
+func (s *InvitationService) send(ctx context.Context, invitation *models.Invitation, token, inviter string) {
+	msg := mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to BartenderApp",
+		Body: fmt.Sprintf(
+			"Hi,\n\n%s invited you to join BartenderApp as %s. "+
+				"Open the link below to choose your username and password. It is valid for %s.\n\n%s\n",
+			inviter, invitation.Role, s.policy.TokenTTL, s.acceptLink(token)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		logging.FromContext(ctx).Error("Error sending invitation mail", "error", err)
+	}
+}
+
+// acceptLink builds the link to the frontend invitation page
+func (s *InvitationService) acceptLink(token string) string {
+	separator := "?"
+	if strings.Contains(s.policy.AcceptURL, "?") {
+		separator = "&"
+	}
+	return s.policy.AcceptURL + separator + "token=" + url.QueryEscape(token)
+}
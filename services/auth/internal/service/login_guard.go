@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Login attempt scopes
+const (
+	scopeUser = "user"
+	scopeIP   = "ip"
+)
+
+var (
+	loginLockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_lockouts_total",
+		Help: "Number of temporary login lockouts, by scope (user or ip).",
+	}, []string{"scope"})
+
+	loginThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_throttled_total",
+		Help: "Number of login attempts rejected because of a lockout or progressive delay, by scope.",
+	}, []string{"scope"})
+)
+
+// LoginPolicy configures brute-force protection for password logins
+type LoginPolicy struct {
+	// MaxUserFailures is the number of failures after which a username is locked
+	MaxUserFailures int
+	// MaxIPFailures is the number of failures after which a client IP is locked.
+	// It is higher than the per-user limit because a whole bar usually shares one IP.
+	MaxIPFailures int
+	// LockoutDuration is how long a lock lasts
+	LockoutDuration time.Duration
+	// FailureWindow is how long failures are remembered without new ones
+	FailureWindow time.Duration
+	// DelayAfter is the number of failures after which progressive delays start
+	DelayAfter int
+	// BaseDelay is the first delay; it doubles with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the progressive delay
+	MaxDelay time.Duration
+}
+
+// LoginPolicyFromEnv builds a LoginPolicy from environment variables
+func LoginPolicyFromEnv() LoginPolicy {
+	return LoginPolicy{
+		MaxUserFailures: envInt("LOGIN_MAX_USER_FAILURES", 5),
+		MaxIPFailures:   envInt("LOGIN_MAX_IP_FAILURES", 50),
+		LockoutDuration: envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		FailureWindow:   envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		DelayAfter:      envInt("LOGIN_DELAY_AFTER", 2),
+		BaseDelay:       envDuration("LOGIN_DELAY_BASE", time.Second),
+		MaxDelay:        envDuration("LOGIN_DELAY_MAX", 30*time.Second),
+	}
+}
+
+// LoginBlockedError is returned when a login is refused before the password
+// is checked because of too many recent failures
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+// Error implements the error interface
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, account temporarily locked"
+	}
+	return "too many failed login attempts, try again later"
+}
+
+// LoginGuard tracks failed logins per username and per client IP and decides
+// whether a new attempt may be made
+type LoginGuard struct {
+	repo   *repository.LoginAttemptRepository
+	policy LoginPolicy
+}
+
+// NewLoginGuard creates a new login guard
+func NewLoginGuard(repo *repository.LoginAttemptRepository, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{
+		repo:   repo,
+		policy: policy,
+	}
+}
+
+// Reserve returns a LoginBlockedError if the username or client IP is locked
+// or still has to wait before the next attempt. Otherwise the attempt counts
+// as failed until it is released with RecordSuccess or Release, so concurrent
+// guesses are throttled like consecutive ones.
+func (g *LoginGuard) Reserve(ctx context.Context, username, clientIP string) error {
+	var reserved []attemptKey
+	for _, k := range g.keys(username, clientIP) {
+		err := g.repo.Reserve(ctx, k.scope, k.key, g.policy.FailureWindow, func(attempt *models.LoginAttempt) error {
+			return g.check(k.scope, attempt, time.Now())
+		})
+		if err != nil {
+			g.release(ctx, reserved)
+
+			var blocked *LoginBlockedError
+			if errors.As(err, &blocked) {
+				return err
+			}
+			return fmt.Errorf("failed to check login attempts: %w", err)
+		}
+		reserved = append(reserved, k)
+	}
+
+	return nil
+}
+
+// check returns a LoginBlockedError if an attempt of a scope is not allowed at
+// now
+func (g *LoginGuard) check(scope string, attempt *models.LoginAttempt, now time.Time) error {
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		loginThrottled.WithLabelValues(scope).Inc()
+		return &LoginBlockedError{RetryAfter: attempt.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if next := attempt.LastFailedAt.Add(g.delay(attempt.Failures)); now.Before(next) {
+		loginThrottled.WithLabelValues(scope).Inc()
+		return &LoginBlockedError{RetryAfter: next.Sub(now)}
+	}
+
+	return nil
+}
+
+// RecordFailure marks a reserved attempt as failed and locks the username or
+// client IP once its limit is reached
+func (g *LoginGuard) RecordFailure(ctx context.Context, username, clientIP string) {
+	for _, k := range g.keys(username, clientIP) {
+		attempt, err := g.repo.Get(ctx, k.scope, k.key)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error recording failed login", "error", err)
+			continue
+		}
+
+		if attempt != nil && attempt.LockedUntil == nil && attempt.Failures >= k.maxFailures {
+			if err := g.repo.Lock(ctx, k.scope, k.key, time.Now().Add(g.policy.LockoutDuration)); err != nil {
+				logging.FromContext(ctx).Error("Error locking login", "error", err)
+				continue
+			}
+			loginLockouts.WithLabelValues(k.scope).Inc()
+			logging.FromContext(ctx).Warn("Login locked", "scope", k.scope, "key", k.key, "failures", attempt.Failures)
+		}
+	}
+}
+
+// Release takes back a reserved attempt that neither failed nor completed the
+// login, e.g. a correct password that still needs a second factor
+func (g *LoginGuard) Release(ctx context.Context, username, clientIP string) {
+	g.release(ctx, g.keys(username, clientIP))
+}
+
+// release takes back the reserved attempts of keys
+func (g *LoginGuard) release(ctx context.Context, keys []attemptKey) {
+	for _, k := range keys {
+		if err := g.repo.Release(ctx, k.scope, k.key); err != nil {
+			logging.FromContext(ctx).Error("Error releasing login attempt", "error", err)
+		}
+	}
+}
+
+// RecordSuccess clears the failures of a username and releases the attempt
+// of the client IP. Earlier failures of the client IP are kept so that a
+// valid account cannot be used to reset the IP limit.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, username, clientIP string) {
+	if err := g.repo.Reset(ctx, scopeUser, normalizeUsername(username)); err != nil {
+		logging.FromContext(ctx).Error("Error resetting failed logins", "error", err)
+	}
+	if clientIP != "" {
+		g.release(ctx, []attemptKey{{scope: scopeIP, key: clientIP}})
+	}
+}
+
+// PurgeExpired removes failures older than the failure window, including
+// those of usernames that do not exist
+func (g *LoginGuard) PurgeExpired(ctx context.Context) (int64, error) {
+	return g.repo.PurgeExpired(ctx, g.policy.FailureWindow)
+}
+
+// Unlock clears the failures and any lock of a username
+func (g *LoginGuard) Unlock(ctx context.Context, username string) error {
+	return g.repo.Reset(ctx, scopeUser, normalizeUsername(username))
+}
+
+// delay returns how long to wait after the given number of failures
+func (g *LoginGuard) delay(failures int) time.Duration {
+	if failures <= g.policy.DelayAfter {
+		return 0
+	}
+
+	delay := g.policy.BaseDelay
+	for i := g.policy.DelayAfter + 1; i < failures && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.policy.MaxDelay {
+		delay = g.policy.MaxDelay
+	}
+
+	return delay
+}
+
+// attemptKey identifies a tracked scope and its failure limit
+type attemptKey struct {
+	scope       string
+	key         string
+	maxFailures int
+}
+
+// keys returns the tracked keys for a login attempt
+func (g *LoginGuard) keys(username, clientIP string) []attemptKey {
+	keys := []attemptKey{{scope: scopeUser, key: normalizeUsername(username), maxFailures: g.policy.MaxUserFailures}}
+	if clientIP != "" {
+		keys = append(keys, attemptKey{scope: scopeIP, key: clientIP, maxFailures: g.policy.MaxIPFailures})
+	}
+	return keys
+}
+
+// normalizeUsername makes failure tracking independent of username case
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
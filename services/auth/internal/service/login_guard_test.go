@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+func TestLoginGuardCheck(t *testing.T) {
+	g := NewLoginGuard(nil, LoginPolicy{DelayAfter: 2, BaseDelay: time.Second, MaxDelay: 8 * time.Second})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Minute)
+	earlier := now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		attempt    models.LoginAttempt
+		wantLocked bool
+		wantRetry  time.Duration
+	}{
+		{"reserved first attempt", models.LoginAttempt{Failures: 0, LastFailedAt: now}, false, 0},
+		{"failures below the delay", models.LoginAttempt{Failures: 2, LastFailedAt: now}, false, 0},
+		{"first delay", models.LoginAttempt{Failures: 3, LastFailedAt: now}, false, time.Second},
+		{"doubled delay", models.LoginAttempt{Failures: 4, LastFailedAt: now}, false, 2 * time.Second},
+		{"capped delay", models.LoginAttempt{Failures: 20, LastFailedAt: now}, false, 8 * time.Second},
+		{"delay over", models.LoginAttempt{Failures: 3, LastFailedAt: now.Add(-2 * time.Second)}, false, 0},
+		{"locked", models.LoginAttempt{Failures: 5, LastFailedAt: now, LockedUntil: &later}, true, time.Minute},
+		{"lock expired", models.LoginAttempt{Failures: 1, LastFailedAt: earlier, LockedUntil: &earlier}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.check(scopeUser, &tt.attempt, now)
+			if tt.wantRetry == 0 {
+				if err != nil {
+					t.Fatalf("check() error = %v, want none", err)
+				}
+				return
+			}
+
+			var blocked *LoginBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("check() error = %v, want a LoginBlockedError", err)
+			}
+			if blocked.Locked != tt.wantLocked || blocked.RetryAfter != tt.wantRetry {
+				t.Errorf("check() = %+v, want locked %v, retry after %v", blocked, tt.wantLocked, tt.wantRetry)
+			}
+		})
+	}
+}
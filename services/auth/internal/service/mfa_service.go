@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued at once
+	recoveryCodeCount = 10
+
+	// recoveryCodeAlphabet avoids characters that are easy to confuse
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// errInvalidMFACode is returned for wrong, replayed or malformed codes
+var errInvalidMFACode = errors.New("invalid two-factor authentication code")
+
+// MFAService handles TOTP two-factor authentication
+type MFAService struct {
+	mfaRepo       *repository.MFARepository
+	userRepo      *repository.UserRepository
+	requiredRoles []string
+}
+
+// NewMFAService creates a new MFA service. Users with one of requiredRoles
+// must enroll before they can log in.
+func NewMFAService(mfaRepo *repository.MFARepository, userRepo *repository.UserRepository, requiredRoles []string) *MFAService {
+	return &MFAService{
+		mfaRepo:       mfaRepo,
+		userRepo:      userRepo,
+		requiredRoles: requiredRoles,
+	}
+}
+
+// MFARequiredRolesFromEnv reads the comma separated MFA_REQUIRED_ROLES variable
+func MFARequiredRolesFromEnv() []string {
+	var roles []string
+	for _, role := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Required reports whether the role of the user enforces two-factor authentication
+func (s *MFAService) Required(user *models.User) bool {
+	for _, role := range s.requiredRoles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether the user has confirmed a TOTP enrollment
+func (s *MFAService) Enabled(ctx context.Context, userID int) (bool, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return mfa != nil && mfa.EnabledAt != nil, nil
+}
+
+// Enroll starts TOTP enrollment by generating a new secret. The secret only
+// becomes active once a code generated from it is confirmed.
+func (s *MFAService) Enroll(ctx context.Context, userID int) (*models.MFAEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.SavePending(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totpURI(secret, user.Username),
+	}, nil
+}
+
+// Confirm enables a pending enrollment if the code matches the secret and
+// returns a fresh set of recovery codes
+func (s *MFAService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mfa == nil {
+		return nil, errors.New("two-factor enrollment has not been started")
+	}
+
+	if mfa.EnabledAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	step, ok := verifyTOTP(mfa.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code or an unused recovery code of an enrolled user.
+// Each TOTP code and each recovery code is accepted only once.
+func (s *MFAService) Verify(ctx context.Context, userID int, code string) error {
+	mfa, err := s.mfaRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if mfa == nil || mfa.EnabledAt == nil {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if step, ok := verifyTOTP(mfa.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.mfaRepo.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidMFACode
+	}
+
+	return nil
+}
+
+// Disable removes the enrollment of a user after checking a current code
+func (s *MFAService) Disable(ctx context.Context, userID int, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.mfaRepo.Delete(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user after checking a current code
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Reset removes the enrollment of another user, e.g. after a lost phone
+func (s *MFAService) Reset(ctx context.Context, userID int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to reset two-factor authentication")
+	}
+
+	// Make sure the user exists
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.mfaRepo.Delete(ctx, userID)
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b strings.Builder
+		for j := 0; j < 8; j++ {
+			if j == 4 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode normalizes a recovery code and returns its SHA-256 hash
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
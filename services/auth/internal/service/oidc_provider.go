@@ -0,0 +1,428 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+// oidcProviderName restricts provider names, which appear in URLs and
+// environment variable names
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// GroupRole maps members of an identity provider group to a role
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// OIDCProviderConfig configures an OpenID Connect provider users can log in with
+type OIDCProviderConfig struct {
+	// Name identifies the provider in URLs, e.g. google
+	Name string
+	// DisplayName is shown on the login button
+	DisplayName string
+	// Issuer is the exact issuer URL; the provider metadata is discovered from it
+	Issuer string
+	// AuthorizationURL overrides the discovered authorization endpoint, e.g.
+	// when browsers reach the provider under another host name than this service
+	AuthorizationURL string
+	ClientID         string
+	ClientSecret     string
+	// RedirectURL is the frontend page the provider redirects back to
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim is the ID token claim listing the groups of the user
+	GroupsClaim string
+	// GroupRoles maps groups to roles. The first mapping whose group the user
+	// is a member of decides the role, which is applied at every login.
+	GroupRoles []GroupRole
+	// DefaultRole is used when no group matches. Without it such users are refused.
+	DefaultRole string
+	// AutoCreate creates users on their first login instead of refusing them
+	AutoCreate bool
+	// TrustEmail links accounts by e-mail address even if the provider does not
+	// report it as verified, e.g. for Entra ID which omits email_verified
+	TrustEmail bool
+	// AllowedDomains restricts logins to accounts of these domains, taken from
+	// the hd claim of Google Workspace accounts or the e-mail address. Empty
+	// allows accounts of any domain.
+	AllowedDomains []string
+}
+
+// OIDCProvidersFromEnv builds the configured OpenID Connect providers. The
+// comma separated OIDC_PROVIDERS lists their names; the settings of each are
+// read from OIDC_<NAME>_* variables.
+func OIDCProvidersFromEnv() ([]OIDCProviderConfig, error) {
+	var configs []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		env := func(key, defaultValue string) string {
+			if value := strings.TrimSpace(os.Getenv(prefix + key)); value != "" {
+				return value
+			}
+			return defaultValue
+		}
+
+		config := OIDCProviderConfig{
+			Name:             name,
+			DisplayName:      env("DISPLAY_NAME", name),
+			Issuer:           env("ISSUER", ""),
+			AuthorizationURL: env("AUTHORIZATION_URL", ""),
+			ClientID:         env("CLIENT_ID", ""),
+			ClientSecret:     env("CLIENT_SECRET", ""),
+			RedirectURL:      env("REDIRECT_URL", ""),
+			Scopes:           strings.Fields(env("SCOPES", "openid email profile")),
+			GroupsClaim:      env("GROUPS_CLAIM", "groups"),
+			DefaultRole:      env("DEFAULT_ROLE", ""),
+			AutoCreate:       env("AUTO_CREATE", "false") == "true",
+			TrustEmail:       env("TRUST_EMAIL", "false") == "true",
+		}
+
+		for _, domain := range strings.Split(env("ALLOWED_DOMAINS", ""), ",") {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				config.AllowedDomains = append(config.AllowedDomains, domain)
+			}
+		}
+
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+
+		// Mappings are written as group=role pairs, e.g. "bar-managers=manager,staff=bartender"
+		for _, mapping := range strings.Split(env("GROUP_ROLES", ""), ",") {
+			if mapping = strings.TrimSpace(mapping); mapping == "" {
+				continue
+			}
+			group, role, ok := strings.Cut(mapping, "=")
+			if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+				return nil, fmt.Errorf("invalid %sGROUP_ROLES entry %q, expected group=role", prefix, mapping)
+			}
+			config.GroupRoles = append(config.GroupRoles, GroupRole{
+				Group: strings.TrimSpace(group),
+				Role:  strings.TrimSpace(role),
+			})
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// DomainAllowed reports whether a provider account belongs to one of the
+// allowed domains. The hosted domain is authoritative when the provider sends
+// one; otherwise the e-mail address counts if the provider vouches for it.
+func (c OIDCProviderConfig) DomainAllowed(identity *OIDCIdentity) bool {
+	if len(c.AllowedDomains) == 0 {
+		return true
+	}
+
+	domain := strings.ToLower(identity.HostedDomain)
+	if domain == "" {
+		if !identity.EmailVerified && !c.TrustEmail {
+			return false
+		}
+		at := strings.LastIndex(identity.Email, "@")
+		if at < 0 {
+			return false
+		}
+		domain = strings.ToLower(identity.Email[at+1:])
+	}
+
+	return containsString(c.AllowedDomains, domain)
+}
+
+// oidcMetadata is the part of the provider metadata used by the relying party
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is the verified identity from an ID token
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// HostedDomain is the Google Workspace domain of the account, if any
+	HostedDomain string
+	Username     string
+	Groups       []string
+}
+
+// OIDCProvider is an OpenID Connect provider. Its metadata is discovered on
+// first use and its signing keys are cached.
+type OIDCProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	keys     *auth.JWKSVerifier
+}
+
+// NewOIDCProvider creates a provider from its configuration
+func NewOIDCProvider(config OIDCProviderConfig) *OIDCProvider {
+	return &OIDCProvider{
+		config: config,
+		client: tracing.NewClient(10 * time.Second),
+	}
+}
+
+// Config returns the configuration of the provider
+func (p *OIDCProvider) Config() OIDCProviderConfig {
+	return p.config
+}
+
+// AuthCodeURL returns the URL the browser is sent to for logging in. The code
+// challenge is derived from the PKCE code verifier with S256.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := metadata.AuthorizationEndpoint
+	if p.config.AuthorizationURL != "" {
+		endpoint = p.config.AuthorizationURL
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity
+// from the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider rejected authorization code: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("provider returned no ID token")
+	}
+
+	return p.verifyIDToken(body.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and extracts the identity
+func (p *OIDCProvider) verifyIDToken(rawToken, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := p.keys.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// Make sure the algorithm matches the type of the key
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+		case ed25519.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+		default:
+			return nil, fmt.Errorf("unsupported key type for key %q", kid)
+		}
+
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, errors.New("invalid ID token: missing expiry")
+	}
+
+	if value, _ := claims["nonce"].(string); value == "" || value != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+
+	// A token issued to several clients must name this one as authorized party
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, errors.New("invalid ID token: unexpected authorized party")
+		}
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	identity := &OIDCIdentity{
+		Subject:      subject,
+		Email:        stringClaim(claims, "email"),
+		HostedDomain: stringClaim(claims, "hd"),
+		Username:     stringClaim(claims, "preferred_username"),
+		Groups:       stringsClaim(claims, p.config.GroupsClaim),
+	}
+
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity, nil
+}
+
+// discover fetches the provider metadata once and sets up the key cache
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: unexpected status %d", p.config.Name, resp.StatusCode)
+	}
+
+	var metadata oidcMetadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode OIDC provider metadata: %w", err)
+	}
+
+	// The issuer must match exactly, as it is compared with the iss claim of ID tokens
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC provider %s reports issuer %q", p.config.Name, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider %s metadata is incomplete", p.config.Name)
+	}
+
+	p.metadata = &metadata
+	p.keys = auth.NewJWKSVerifier(metadata.JWKSURI, 0)
+
+	return p.metadata, nil
+}
+
+// stringClaim returns a string claim or an empty string
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim returns a claim that is a list of strings or a single string
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
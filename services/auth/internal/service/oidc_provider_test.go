@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+)
+
+func TestOIDCProvidersFromEnvAllowedDomains(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "google")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "client")
+	t.Setenv("OIDC_GOOGLE_REDIRECT_URL", "http://localhost:3000/login/callback")
+	t.Setenv("OIDC_GOOGLE_ALLOWED_DOMAINS", " Example.com, ,bar.example.org")
+
+	configs, err := OIDCProvidersFromEnv()
+	if err != nil {
+		t.Fatalf("OIDCProvidersFromEnv() error = %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("OIDCProvidersFromEnv() returned %d providers, want 1", len(configs))
+	}
+
+	want := []string{"example.com", "bar.example.org"}
+	if got := configs[0].AllowedDomains; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllowedDomains = %q, want %q", got, want)
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	restricted := OIDCProviderConfig{AllowedDomains: []string{"example.com"}}
+	trusting := OIDCProviderConfig{AllowedDomains: []string{"example.com"}, TrustEmail: true}
+
+	tests := []struct {
+		name     string
+		config   OIDCProviderConfig
+		identity OIDCIdentity
+		want     bool
+	}{
+		{"no restriction", OIDCProviderConfig{}, OIDCIdentity{Email: "ana@gmail.com"}, true},
+		{"verified e-mail", restricted, OIDCIdentity{Email: "ana@Example.com", EmailVerified: true}, true},
+		{"other domain", restricted, OIDCIdentity{Email: "ana@gmail.com", EmailVerified: true}, false},
+		{"subdomain", restricted, OIDCIdentity{Email: "ana@evil.example.com", EmailVerified: true}, false},
+		{"suffix", restricted, OIDCIdentity{Email: "ana@notexample.com", EmailVerified: true}, false},
+		{"unverified e-mail", restricted, OIDCIdentity{Email: "ana@example.com"}, false},
+		{"trusted e-mail", trusting, OIDCIdentity{Email: "ana@example.com"}, true},
+		{"no e-mail", trusting, OIDCIdentity{}, false},
+		{"hosted domain", restricted, OIDCIdentity{HostedDomain: "example.com"}, true},
+		{"other hosted domain", restricted, OIDCIdentity{Email: "ana@example.com", EmailVerified: true, HostedDomain: "gmail.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.DomainAllowed(&tt.identity); got != tt.want {
+				t.Errorf("DomainAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	signer, err := auth.NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signer.JWKS())
+	}))
+	defer jwks.Close()
+
+	provider := NewOIDCProvider(OIDCProviderConfig{
+		Issuer:      "https://idp.example.com",
+		ClientID:    "bartender",
+		GroupsClaim: "groups",
+	})
+	provider.keys = auth.NewJWKSVerifier(jwks.URL, 0)
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            "https://idp.example.com",
+			"aud":            "bartender",
+			"sub":            "1234",
+			"exp":            now.Add(time.Hour).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          "nonce",
+			"email":          "ana@example.com",
+			"email_verified": "true",
+			"hd":             "example.com",
+			"groups":         []string{"staff"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		wantErr string
+	}{
+		{"valid", func(jwt.MapClaims) {}, ""},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "invalid ID token"},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "other" }, "invalid ID token"},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, "invalid ID token"},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, "missing expiry"},
+		{"other nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, "nonce mismatch"},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, "nonce mismatch"},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, "missing subject"},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{"bartender", "other"} }, "unexpected authorized party"},
+		{"several audiences with azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{"bartender", "other"}
+			c["azp"] = "bartender"
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+			token, err := signer.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := provider.verifyIDToken(token, "nonce")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyIDToken() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyIDToken() error = %v", err)
+			}
+
+			want := &OIDCIdentity{
+				Subject:       "1234",
+				Email:         "ana@example.com",
+				EmailVerified: true,
+				HostedDomain:  "example.com",
+				Groups:        []string{"staff"},
+			}
+			if !reflect.DeepEqual(identity, want) {
+				t.Errorf("verifyIDToken() = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsUnsignedTokens(t *testing.T) {
+	provider := NewOIDCProvider(OIDCProviderConfig{Issuer: "https://idp.example.com", ClientID: "bartender"})
+	provider.keys = auth.NewJWKSVerifier("http://127.0.0.1:0", 0)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"iss":   "https://idp.example.com",
+		"aud":   "bartender",
+		"sub":   "1234",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce",
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.verifyIDToken(token, "nonce"); err == nil {
+		t.Fatal("verifyIDToken() accepted an unsigned token")
+	}
+}
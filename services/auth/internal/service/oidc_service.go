@@ -0,0 +1,563 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/metrics"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// oidcStateTTL is how long a user has to log in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownOIDCProvider is returned for providers that are not configured
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+
+	// errExternalLoginFailed hides provider errors from clients; they are logged
+	errExternalLoginFailed = errors.New("external login failed")
+
+	// errDomainNotAllowed is returned for accounts outside the allowed domains
+	errDomainNotAllowed = errors.New("accounts of this domain cannot log in here")
+
+	// errExplicitLinkRequired is returned instead of linking protected users by e-mail address
+	errExplicitLinkRequired = errors.New("log in with your password and link this account in your account settings")
+)
+
+// adminPermissions make an account worth taking over. Users whose role grants
+// any of them are never linked to provider accounts by e-mail address.
+var adminPermissions = []string{
+	auth.PermUsersWrite,
+	auth.PermUsersDelete,
+	auth.PermUsersErase,
+	auth.PermUsersSecurity,
+	auth.PermUsersImpersonate,
+	auth.PermRolesManage,
+	auth.PermTerminalsManage,
+	auth.PermAPIClientsManage,
+	auth.PermAuditRead,
+}
+
+// OIDCService handles logins with external OpenID Connect providers. Provider
+// accounts are linked to users by their subject ID; the first login links an
+// existing user with the same verified e-mail address or creates a new one.
+// Administrators and users with two-factor authentication are not linked by
+// e-mail address; they link accounts from their account settings instead.
+type OIDCService struct {
+	providers    map[string]*OIDCProvider
+	names        []string
+	identityRepo *repository.ExternalIdentityRepository
+	userRepo     *repository.UserRepository
+	roleRepo     *repository.RoleRepository
+	authService  *AuthService
+	recorder     audit.Recorder
+}
+
+// NewOIDCService creates a new OIDC service for the configured providers
+func NewOIDCService(configs []OIDCProviderConfig, identityRepo *repository.ExternalIdentityRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, authService *AuthService, recorder audit.Recorder) *OIDCService {
+	s := &OIDCService{
+		providers:    make(map[string]*OIDCProvider, len(configs)),
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		authService:  authService,
+		recorder:     recorder,
+	}
+
+	for _, config := range configs {
+		if config.AutoCreate && len(config.AllowedDomains) == 0 {
+			slog.Warn("OIDC provider creates users for accounts of any domain", "provider", config.Name)
+		}
+		s.providers[config.Name] = NewOIDCProvider(config)
+		s.names = append(s.names, config.Name)
+	}
+
+	return s
+}
+
+// Providers lists the configured providers in configuration order
+func (s *OIDCService) Providers() []models.OIDCProvider {
+	providers := make([]models.OIDCProvider, 0, len(s.names))
+	for _, name := range s.names {
+		config := s.providers[name].Config()
+		providers = append(providers, models.OIDCProvider{
+			Name:        config.Name,
+			DisplayName: config.DisplayName,
+		})
+	}
+	return providers
+}
+
+// Authorize starts a login with a provider. The state, nonce and PKCE code
+// verifier are stored so that the callback can be checked.
+func (s *OIDCService) Authorize(ctx context.Context, name string) (*models.OIDCAuthorization, error) {
+	return s.authorize(ctx, name, nil)
+}
+
+// AuthorizeLink starts linking a provider account to the logged in user. The
+// user confirms it with their current password or a two-factor code, so a
+// stolen access token cannot attach a permanent login. The provider redirects
+// back like for a login, but the code is passed to Link.
+func (s *OIDCService) AuthorizeLink(ctx context.Context, name string, req models.OIDCLinkRequest, clientIP string, claims *auth.Claims) (*models.OIDCAuthorization, error) {
+	if _, ok := s.providers[name]; !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	// Make sure the caller is a user
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.Reauthenticate(ctx, user, req.Password, req.Code, clientIP); err != nil {
+		return nil, err
+	}
+
+	return s.authorize(ctx, name, &user.ID)
+}
+
+// authorize stores a pending login or, with a user ID, a pending link and
+// returns the URL to send the browser to
+func (s *OIDCService) authorize(ctx context.Context, name string, linkUserID *int) (*models.OIDCAuthorization, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := newLinkToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		secrets[i] = secret
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error starting external login", "provider", name, "error", err)
+		return nil, errExternalLoginFailed
+	}
+
+	record := &models.OIDCLoginState{
+		StateHash:    auth.HashSecretKey(state),
+		Provider:     name,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+		LinkUserID:   linkUserID,
+	}
+	if err := s.identityRepo.CreateState(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return &models.OIDCAuthorization{
+		AuthorizationURL: authURL,
+		State:            state,
+		ExpiresAt:        record.ExpiresAt,
+	}, nil
+}
+
+// Login completes a login with the code and state the provider redirected
+// back with and issues the usual tokens. The role of the user is updated from
+// their groups at the provider if it maps groups to roles. Users with
+// two-factor authentication, or whose role requires it, get an MFA challenge
+// like after a password login.
+func (s *OIDCService) Login(ctx context.Context, name string, req models.OIDCCallbackRequest) (*models.LoginResponse, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	if req.Code == "" || req.State == "" {
+		return nil, errors.New("code and state are required")
+	}
+
+	// States are single use and bound to the provider they were issued for.
+	// States of links cannot be used to log in.
+	state, err := s.identityRepo.ConsumeState(ctx, auth.HashSecretKey(req.State))
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != name || state.LinkUserID != nil {
+		return nil, repository.ErrInvalidOIDCState
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error completing external login", "provider", name, "error", err)
+		metrics.LoginFailed(metrics.LoginOIDC)
+		return nil, errExternalLoginFailed
+	}
+
+	// Accounts outside the allowed domains are refused before anything is
+	// looked up, linked or created
+	config := provider.Config()
+	if !config.DomainAllowed(identity) {
+		metrics.LoginFailed(metrics.LoginOIDC)
+		return nil, errDomainNotAllowed
+	}
+
+	role, err := s.mapRole(ctx, config, identity.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.findOrCreateUser(ctx, config, identity, role)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deactivated users cannot log in, whatever the provider says
+	if !user.Active {
+		s.authService.recordLoginFailure(ctx, metrics.LoginOIDC, user.Username, user)
+		return nil, errAccountDeactivated
+	}
+
+	// Keep the role in sync with the groups at the provider
+	if len(config.GroupRoles) > 0 && user.Role != role {
+		if err := s.syncRole(ctx, config, user, role); err != nil {
+			return nil, err
+		}
+	}
+
+	// The provider only stands in for the password; a second factor is
+	// required just the same
+	mfaEnabled, err := s.authService.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+
+	if mfaEnabled || s.authService.mfaService.Required(user) {
+		return s.authService.newMFAChallenge(user, []string{"oidc"}, !mfaEnabled)
+	}
+
+	metrics.LoginSucceeded(metrics.LoginOIDC)
+
+	return s.authService.startSession(ctx, user, []string{"oidc"}, req.DeviceName)
+}
+
+// Link completes a link started with AuthorizeLink and links the provider
+// account to the logged in user. The state proves that the user confirmed the
+// link in AuthorizeLink within the last oidcStateTTL.
+func (s *OIDCService) Link(ctx context.Context, name string, req models.OIDCCallbackRequest, claims *auth.Claims) (*models.ExternalIdentity, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	if req.Code == "" || req.State == "" {
+		return nil, errors.New("code and state are required")
+	}
+
+	// The state must have been issued to this user for a link
+	state, err := s.identityRepo.ConsumeState(ctx, auth.HashSecretKey(req.State))
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != name || state.LinkUserID == nil || *state.LinkUserID != claims.UserID {
+		return nil, repository.ErrInvalidOIDCState
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error linking external account", "provider", name, "error", err)
+		return nil, errExternalLoginFailed
+	}
+
+	if !provider.Config().DomainAllowed(identity) {
+		return nil, errDomainNotAllowed
+	}
+
+	if _, err := s.identityRepo.GetBySubject(ctx, name, identity.Subject); err == nil {
+		return nil, errors.New("this account is already linked to a user")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.ExternalIdentity{
+		UserID:   user.ID,
+		Provider: name,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := s.identityRepo.Create(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to link account: %w", err)
+	}
+	s.recordLink(ctx, user, link)
+
+	return link, nil
+}
+
+// ListIdentities returns the provider accounts linked to a user. Users can
+// list their own; other users require users:security.
+func (s *OIDCService) ListIdentities(ctx context.Context, userID int, claims *auth.Claims) ([]models.ExternalIdentity, error) {
+	// Check permissions
+	if claims.UserID != userID && !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return nil, errors.New("missing permission to view linked accounts")
+	}
+
+	// Make sure the user exists
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.identityRepo.ListByUser(ctx, userID)
+}
+
+// Unlink removes a linked provider account from a user, e.g. after the
+// account was taken over at the provider
+func (s *OIDCService) Unlink(ctx context.Context, userID, identityID int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to unlink accounts")
+	}
+
+	if err := s.identityRepo.Delete(ctx, userID, identityID); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionIdentityUnlinked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(userID),
+		Changes: map[string]audit.Change{
+			"identity_id": {From: identityID, To: nil},
+		},
+	})
+
+	return nil
+}
+
+// mapRole returns the role for the groups of a user. Without group mappings
+// the default role is returned, which may be empty.
+func (s *OIDCService) mapRole(ctx context.Context, config OIDCProviderConfig, groups []string) (string, error) {
+	role := config.DefaultRole
+	for _, mapping := range config.GroupRoles {
+		if containsString(groups, mapping.Group) {
+			role = mapping.Role
+			break
+		}
+	}
+
+	if role == "" {
+		if len(config.GroupRoles) > 0 {
+			return "", errors.New("none of your groups grants access")
+		}
+		return "", nil
+	}
+
+	if _, err := s.roleRepo.GetByName(ctx, role); err != nil {
+		logging.FromContext(ctx).Error("OIDC provider maps to unknown role", "provider", config.Name, "role", role)
+		return "", errExternalLoginFailed
+	}
+
+	return role, nil
+}
+
+// findOrCreateUser returns the user linked to a provider account. Unlinked
+// accounts are linked to the user with the same verified e-mail address, or
+// get a new user if the provider allows it. Users who must link accounts
+// themselves are refused rather than linked.
+func (s *OIDCService) findOrCreateUser(ctx context.Context, config OIDCProviderConfig, identity *OIDCIdentity, role string) (*models.User, error) {
+	linked, err := s.identityRepo.GetBySubject(ctx, config.Name, identity.Subject)
+	if err == nil {
+		if err := s.identityRepo.RecordLogin(ctx, linked.ID, identity.Email); err != nil {
+			return nil, err
+		}
+		return s.userRepo.GetByID(ctx, linked.UserID)
+	}
+
+	link := &models.ExternalIdentity{
+		Provider: config.Name,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	// Link an existing user by e-mail address, but only if the provider vouches for it
+	if identity.Email != "" && (identity.EmailVerified || config.TrustEmail) {
+		if user, err := s.userRepo.GetByEmail(ctx, identity.Email); err == nil {
+			explicit, err := s.requiresExplicitLink(ctx, user)
+			if err != nil {
+				return nil, err
+			}
+			if explicit {
+				return nil, errExplicitLinkRequired
+			}
+
+			link.UserID = user.ID
+			if err := s.identityRepo.Create(ctx, link); err != nil {
+				return nil, fmt.Errorf("failed to link account: %w", err)
+			}
+			s.recordLink(ctx, user, link)
+			return user, nil
+		}
+	}
+
+	if !config.AutoCreate {
+		return nil, errors.New("no user is linked to this account")
+	}
+	if role == "" {
+		return nil, errors.New("no role is configured for new users")
+	}
+	if identity.Email == "" {
+		return nil, errors.New("the identity provider did not share an e-mail address")
+	}
+
+	username, err := s.availableUsername(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The user logs in at the provider; the password is random and unknown to anyone
+	password, err := newLinkToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:     username,
+		Email:        identity.Email,
+		Role:         role,
+		PasswordHash: passwordHash,
+	}
+	if err := s.identityRepo.CreateWithUser(ctx, user, link); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	user.PasswordHash = ""
+
+	audit.Record(ctx, s.recorder, nil, audit.Event{
+		ActorID:    &user.ID,
+		ActorName:  "oidc:" + config.Name,
+		Action:     audit.ActionUserCreated,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Changes:    audit.Diff(nil, user),
+	})
+	s.recordLink(ctx, user, link)
+
+	return user, nil
+}
+
+// requiresExplicitLink reports whether provider accounts may only be linked
+// to a user from their account settings. Whoever controls an e-mail address at
+// a provider must not be able to take over administrators or to skip a
+// second factor.
+func (s *OIDCService) requiresExplicitLink(ctx context.Context, user *models.User) (bool, error) {
+	mfaEnabled, err := s.authService.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+	if mfaEnabled || s.authService.mfaService.Required(user) {
+		return true, nil
+	}
+
+	permissions, err := s.roleRepo.GetPermissions(ctx, user.Role)
+	if err != nil {
+		return false, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	return grantsAdminPermission(permissions), nil
+}
+
+// grantsAdminPermission reports whether any of the permissions is an admin permission
+func grantsAdminPermission(permissions []string) bool {
+	for _, permission := range adminPermissions {
+		if containsString(permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncRole applies the role mapped from the groups at the provider. Existing
+// tokens of the user carry the permissions of the old role and are revoked.
+func (s *OIDCService) syncRole(ctx context.Context, config OIDCProviderConfig, user *models.User, role string) error {
+	updatedUser := *user
+	updatedUser.Role = role
+
+	if err := s.userRepo.Update(ctx, &updatedUser); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	if err := s.authService.revokeTokens(ctx, user.ID); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, s.recorder, nil, audit.Event{
+		ActorName:  "oidc:" + config.Name,
+		Action:     audit.ActionUserUpdated,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Changes: map[string]audit.Change{
+			"role": {From: user.Role, To: role},
+		},
+	})
+
+	user.Role = role
+	return nil
+}
+
+// recordLink audits the linking of a provider account
+func (s *OIDCService) recordLink(ctx context.Context, user *models.User, link *models.ExternalIdentity) {
+	audit.Record(ctx, s.recorder, nil, audit.Event{
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+		Action:     audit.ActionIdentityLinked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Changes: map[string]audit.Change{
+			"provider": {From: nil, To: link.Provider},
+			"subject":  {From: nil, To: link.Subject},
+		},
+	})
+}
+
+// availableUsername derives an unused username from the preferred username or
+// e-mail address of a provider account
+func (s *OIDCService) availableUsername(ctx context.Context, identity *OIDCIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base = identity.Email
+	}
+	base, _, _ = strings.Cut(strings.ToLower(base), "@")
+	base = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, base)
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		if _, err := s.userRepo.GetByUsername(ctx, candidate); err != nil {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("failed to find an available username")
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+)
+
+func TestGrantsAdminPermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []string
+		want        bool
+	}{
+		{"none", nil, false},
+		{"bartender", []string{auth.PermOrdersRead, auth.PermOrdersProcess, auth.PermRecipesRead}, false},
+		{"manager", []string{auth.PermUsersRead, auth.PermReportsRead, auth.PermInventoryWrite}, false},
+		{"user admin", []string{auth.PermUsersRead, auth.PermUsersWrite}, true},
+		{"security", []string{auth.PermUsersSecurity}, true},
+		{"impersonation", []string{auth.PermUsersImpersonate}, true},
+		{"roles", []string{auth.PermRolesManage}, true},
+		{"api clients", []string{auth.PermAPIClientsManage}, true},
+		{"auditor", []string{auth.PermAuditRead}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grantsAdminPermission(tt.permissions); got != tt.want {
+				t.Errorf("grantsAdminPermission(%q) = %v, want %v", tt.permissions, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash schemes. The scheme and its parameters are stored with every
+// hash, so hashes of older schemes keep verifying after the configuration changes.
+const (
+	SchemeArgon2id = "argon2id"
+	SchemeBcrypt   = "bcrypt"
+)
+
+// errUnknownPasswordScheme is returned for hashes that no scheme recognizes
+var errUnknownPasswordScheme = errors.New("unknown password hash scheme")
+
+// PasswordScheme hashes and verifies passwords with one algorithm and one set
+// of parameters
+type PasswordScheme interface {
+	// Name returns the scheme name, e.g. SchemeArgon2id
+	Name() string
+	// Params returns the parameters new hashes are created with
+	Params() string
+	// Hash returns a new hash of password in the scheme's encoded format
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash
+	Verify(hash, password string) (bool, error)
+	// Identify returns the parameters of a hash, or false if the hash is not of this scheme.
+	// It only needs the encoded header, so it also works on hash prefixes.
+	Identify(hash string) (string, bool)
+}
+
+// PasswordHasher hashes new passwords with the current scheme and verifies
+// hashes of all known schemes
+type PasswordHasher struct {
+	current PasswordScheme
+	schemes []PasswordScheme
+}
+
+// NewPasswordHasher creates a hasher that hashes with current and also accepts
+// hashes of the other schemes
+func NewPasswordHasher(current PasswordScheme, others ...PasswordScheme) *PasswordHasher {
+	return &PasswordHasher{
+		current: current,
+		schemes: append([]PasswordScheme{current}, others...),
+	}
+}
+
+// PasswordHasherFromEnv builds a PasswordHasher from environment variables.
+// PASSWORD_HASH_SCHEME selects the scheme of new hashes (argon2id or bcrypt).
+func PasswordHasherFromEnv() (*PasswordHasher, error) {
+	argon := Argon2idScheme{
+		Memory:  uint32(envInt("PASSWORD_ARGON2_MEMORY", 19456)),
+		Time:    uint32(envInt("PASSWORD_ARGON2_TIME", 2)),
+		Threads: uint8(envInt("PASSWORD_ARGON2_THREADS", 1)),
+	}
+	bcryptScheme := BcryptScheme{Cost: envInt("PASSWORD_BCRYPT_COST", 12)}
+
+	if bcryptScheme.Cost < bcrypt.MinCost || bcryptScheme.Cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if err := argon.validate(); err != nil {
+		return nil, err
+	}
+
+	switch scheme := os.Getenv("PASSWORD_HASH_SCHEME"); scheme {
+	case "", SchemeArgon2id:
+		return NewPasswordHasher(argon, bcryptScheme), nil
+	case SchemeBcrypt:
+		return NewPasswordHasher(bcryptScheme, argon), nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH_SCHEME %q", scheme)
+	}
+}
+
+// Current returns the scheme used for new hashes
+func (h *PasswordHasher) Current() PasswordScheme {
+	return h.current
+}
+
+// Hash hashes a password with the current scheme
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify reports whether password matches hash, whatever scheme it uses
+func (h *PasswordHasher) Verify(hash, password string) (bool, error) {
+	for _, scheme := range h.schemes {
+		if _, ok := scheme.Identify(hash); ok {
+			return scheme.Verify(hash, password)
+		}
+	}
+	return false, errUnknownPasswordScheme
+}
+
+// Identify returns the scheme name and parameters of a hash or hash prefix
+func (h *PasswordHasher) Identify(hash string) (string, string, bool) {
+	for _, scheme := range h.schemes {
+		if params, ok := scheme.Identify(hash); ok {
+			return scheme.Name(), params, true
+		}
+	}
+	return "", "", false
+}
+
+// NeedsRehash reports whether a hash was created with another scheme or other
+// parameters than the current ones
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	params, ok := h.current.Identify(hash)
+	return !ok || params != h.current.Params()
+}
+
+// passwordHasher is used by HashPassword and CheckPassword
+var passwordHasher = NewPasswordHasher(BcryptScheme{Cost: bcrypt.DefaultCost})
+
+// SetPasswordHasher replaces the hasher used for all passwords and PINs
+func SetPasswordHasher(h *PasswordHasher) {
+	passwordHasher = h
+}
+
+// HashPassword hashes a password with the current scheme
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// CheckPassword reports whether password matches a hash of any known scheme
+func CheckPassword(hash, password string) bool {
+	ok, err := passwordHasher.Verify(hash, password)
+	return err == nil && ok
+}
+
+// BcryptScheme hashes passwords with bcrypt
+type BcryptScheme struct {
+	Cost int
+}
+
+// Name implements PasswordScheme
+func (s BcryptScheme) Name() string {
+	return SchemeBcrypt
+}
+
+// Params implements PasswordScheme
+func (s BcryptScheme) Params() string {
+	return fmt.Sprintf("cost=%d", s.Cost)
+}
+
+// Hash implements PasswordScheme
+func (s BcryptScheme) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), s.Cost)
+	return string(bytes), err
+}
+
+// Verify implements PasswordScheme
+func (s BcryptScheme) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Identify implements PasswordScheme for $2a$, $2b$ and $2y$ hashes
+func (s BcryptScheme) Identify(hash string) (string, bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 3 || parts[0] != "" {
+		return "", false
+	}
+
+	switch parts[1] {
+	case "2a", "2b", "2y":
+	default:
+		return "", false
+	}
+
+	cost, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	return fmt.Sprintf("cost=%d", cost), true
+}
+
+// Argon2idScheme hashes passwords with Argon2id. Hashes use the PHC string
+// format: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idScheme struct {
+	// Memory is the memory cost in KiB
+	Memory uint32
+	// Time is the number of passes over the memory
+	Time uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// argon2 salt and key lengths in bytes
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Name implements PasswordScheme
+func (s Argon2idScheme) Name() string {
+	return SchemeArgon2id
+}
+
+// Params implements PasswordScheme
+func (s Argon2idScheme) Params() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", s.Memory, s.Time, s.Threads)
+}
+
+// validate checks the parameters that argon2.IDKey would panic on
+func (s Argon2idScheme) validate() error {
+	if s.Memory < 8*uint32(s.Threads) || s.Time < 1 || s.Threads < 1 {
+		return errors.New("invalid Argon2id parameters")
+	}
+	return nil
+}
+
+// Hash implements PasswordScheme
+func (s Argon2idScheme) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, s.Time, s.Memory, s.Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s",
+		SchemeArgon2id,
+		argon2.Version,
+		s.Params(),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify implements PasswordScheme using the parameters stored in the hash
+func (s Argon2idScheme) Verify(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errors.New("malformed argon2id hash")
+	}
+
+	params, err := parseArgon2Params(parts[2], parts[3])
+	if err != nil {
+		return false, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	if len(key) == 0 {
+		return false, errors.New("malformed argon2id key: empty")
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
+
+// Identify implements PasswordScheme
+func (s Argon2idScheme) Identify(hash string) (string, bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 4 || parts[0] != "" || parts[1] != SchemeArgon2id {
+		return "", false
+	}
+
+	params, err := parseArgon2Params(parts[2], parts[3])
+	if err != nil {
+		return "", false
+	}
+
+	return params.Params(), true
+}
+
+// parseArgon2Params parses the version and parameter segments of a PHC string
+func parseArgon2Params(version, params string) (Argon2idScheme, error) {
+	var v int
+	if _, err := fmt.Sscanf(version, "v=%d", &v); err != nil || v != argon2.Version {
+		return Argon2idScheme{}, errors.New("unsupported argon2id version")
+	}
+
+	var s Argon2idScheme
+	if _, err := fmt.Sscanf(params, "m=%d,t=%d,p=%d", &s.Memory, &s.Time, &s.Threads); err != nil {
+		return Argon2idScheme{}, errors.New("malformed argon2id parameters")
+	}
+	if err := s.validate(); err != nil {
+		return Argon2idScheme{}, err
+	}
+
+	return s, nil
+}
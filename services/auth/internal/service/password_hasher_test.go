@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgon2idVerifyRejectsInvalidParams(t *testing.T) {
+	scheme := Argon2idScheme{Memory: 64, Time: 1, Threads: 1}
+	hash, err := scheme.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	valid := "$" + scheme.Params() + "$"
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{"no passes", "$m=64,t=0,p=1$"},
+		{"no threads", "$m=64,t=1,p=0$"},
+		{"too little memory", "$m=15,t=1,p=2$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := strings.Replace(hash, valid, tt.params, 1)
+			if tampered == hash {
+				t.Fatalf("hash %q does not contain %q", hash, valid)
+			}
+
+			if _, ok := scheme.Identify(tampered); ok {
+				t.Errorf("Identify(%q) accepted the hash", tampered)
+			}
+			if _, err := scheme.Verify(tampered, "correct horse"); err == nil {
+				t.Errorf("Verify(%q) returned no error", tampered)
+			}
+		})
+	}
+
+	if ok, err := scheme.Verify(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("Verify(valid hash) = %v, %v, want true", ok, err)
+	}
+}
+
+func TestArgon2idVerifyRejectsEmptyKey(t *testing.T) {
+	scheme := Argon2idScheme{Memory: 64, Time: 1, Threads: 1}
+	hash, err := scheme.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	empty := hash[:strings.LastIndex(hash, "$")+1]
+
+	if ok, err := scheme.Verify(empty, "anything"); err == nil || ok {
+		t.Errorf("Verify(%q) = %v, %v, want an error", empty, ok, err)
+	}
+}
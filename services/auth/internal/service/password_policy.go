@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// Password policy rules reported in PasswordViolation.Rule
+const (
+	RuleMinLength      = "min_length"
+	RuleMaxLength      = "max_length"
+	RuleCommonPassword = "common_password"
+	RuleReuse          = "reuse"
+)
+
+// maxPasswordBytes is the longest password bcrypt can hash, which stays a
+// supported scheme even when new hashes use Argon2id
+const maxPasswordBytes = 72
+
+//go:embed common_passwords.txt
+var bundledCommonPasswords string
+
+// PasswordViolation describes a single rule a password does not satisfy
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError is returned when a new password breaks one or more rules
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+// Error implements the error interface
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy configures the rules for new passwords
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// HistorySize is the number of previous passwords, including the current
+	// one, that cannot be used again
+	HistorySize int
+	// CommonPasswords are rejected regardless of their length (lowercased)
+	CommonPasswords map[string]bool
+}
+
+// PasswordPolicyFromEnv builds a PasswordPolicy from environment variables.
+// PASSWORD_COMMON_LIST_FILE replaces the bundled list of common passwords.
+func PasswordPolicyFromEnv() (PasswordPolicy, error) {
+	var list io.Reader = strings.NewReader(bundledCommonPasswords)
+	if path := os.Getenv("PASSWORD_COMMON_LIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return PasswordPolicy{}, fmt.Errorf("failed to open common password list: %w", err)
+		}
+		defer f.Close()
+		list = f
+	}
+
+	common, err := readCommonPasswords(list)
+	if err != nil {
+		return PasswordPolicy{}, fmt.Errorf("failed to read common password list: %w", err)
+	}
+
+	return PasswordPolicy{
+		MinLength:       envInt("PASSWORD_MIN_LENGTH", 8),
+		HistorySize:     envInt("PASSWORD_HISTORY_SIZE", 5),
+		CommonPasswords: common,
+	}, nil
+}
+
+// Validate checks a new password against the length and common password rules
+func (p PasswordPolicy) Validate(password string) error {
+	var violations []PasswordViolation
+
+	if n := len([]rune(password)); n < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must not be longer than %d bytes", maxPasswordBytes),
+		})
+	}
+
+	if p.CommonPasswords[strings.ToLower(password)] {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleCommonPassword,
+			Message: "is too common and appears in lists of breached passwords",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// CheckReuse rejects a password that matches one of the given hashes, which
+// are the current password hash followed by the password history
+func (p PasswordPolicy) CheckReuse(password string, hashes []string) error {
+	if p.HistorySize <= 0 {
+		return nil
+	}
+
+	if len(hashes) > p.HistorySize {
+		hashes = hashes[:p.HistorySize]
+	}
+
+	for _, hash := range hashes {
+		if CheckPassword(hash, password) {
+			return &PasswordPolicyError{Violations: []PasswordViolation{{
+				Rule:    RuleReuse,
+				Message: fmt.Sprintf("must differ from the last %d passwords", p.HistorySize),
+			}}}
+		}
+	}
+
+	return nil
+}
+
+// checkNewPassword applies all rules, including reuse, to a new password for a user
+func (p PasswordPolicy) checkNewPassword(ctx context.Context, userRepo *repository.UserRepository, user *models.User, password string) error {
+	if err := p.Validate(password); err != nil {
+		return err
+	}
+
+	if p.HistorySize <= 0 {
+		return nil
+	}
+
+	history, err := userRepo.GetPasswordHistory(ctx, user.ID, p.HistorySize-1)
+	if err != nil {
+		return fmt.Errorf("failed to load password history: %w", err)
+	}
+
+	return p.CheckReuse(password, append([]string{user.PasswordHash}, history...))
+}
+
+// readCommonPasswords reads one password per line, skipping blank lines and # comments
+func readCommonPasswords(r io.Reader) (map[string]bool, error) {
+	common := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		common[strings.ToLower(line)] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return common, nil
+}
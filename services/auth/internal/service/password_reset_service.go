@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/mailer"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// PasswordResetPolicy configures self-service password resets
+type PasswordResetPolicy struct {
+	// TokenTTL is how long a reset link stays valid
+	TokenTTL time.Duration
+	// MinInterval is the minimum time between two reset e-mails to the same user
+	MinInterval time.Duration
+	// ResetURL is the frontend page the link points to; the token is added as a query parameter
+	ResetURL string
+}
+
+// PasswordResetPolicyFromEnv builds a PasswordResetPolicy from environment variables
+func PasswordResetPolicyFromEnv() PasswordResetPolicy {
+	resetURL := os.Getenv("PASSWORD_RESET_URL")
+	if resetURL == "" {
+		resetURL = "http://localhost:3000/reset-password"
+	}
+
+	return PasswordResetPolicy{
+		TokenTTL:    envDuration("PASSWORD_RESET_TTL", time.Hour),
+		MinInterval: envDuration("PASSWORD_RESET_MIN_INTERVAL", time.Minute),
+		ResetURL:    resetURL,
+	}
+}
+
+// PasswordResetService handles forgotten passwords
+type PasswordResetService struct {
+	userRepo          *repository.UserRepository
+	passwordResetRepo *repository.PasswordResetRepository
+	refreshTokenRepo  *repository.RefreshTokenRepository
+	denylist          *auth.SQLDenylist
+	loginGuard        *LoginGuard
+	mailer            mailer.Mailer
+	policy            PasswordResetPolicy
+	passwordPolicy    PasswordPolicy
+}
+
+// NewPasswordResetService creates a new password reset service
+func NewPasswordResetService(userRepo *repository.UserRepository, passwordResetRepo *repository.PasswordResetRepository, refreshTokenRepo *repository.RefreshTokenRepository, denylist *auth.SQLDenylist, loginGuard *LoginGuard, m mailer.Mailer, policy PasswordResetPolicy, passwordPolicy PasswordPolicy) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:          userRepo,
+		passwordResetRepo: passwordResetRepo,
+		refreshTokenRepo:  refreshTokenRepo,
+		denylist:          denylist,
+		loginGuard:        loginGuard,
+		mailer:            m,
+		policy:            policy,
+		passwordPolicy:    passwordPolicy,
+	}
+}
+
+// Forgot e-mails a reset link to the user with the given address. To avoid
+// revealing which addresses have accounts, unknown addresses and throttled
+// requests are not reported as errors, and the link is created and sent in
+// the background so the response takes as long for every address.
+func (s *PasswordResetService) Forgot(ctx context.Context, email, clientIP string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	go s.sendResetLink(context.WithoutCancel(ctx), email, clientIP)
+
+	return nil
+}
+
+// sendResetLink creates a reset token for the active user with the given
+// address, if any, and mails the link. Failures are only logged since the
+// caller has already been answered.
+func (s *PasswordResetService) sendResetLink(ctx context.Context, email, clientIP string) {
+	logger := logging.FromContext(ctx)
+
+	// Deactivated users get no link either, they could not log in with it
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || !user.Active {
+		return
+	}
+
+	// Limit how often a user can be e-mailed
+	last, err := s.passwordResetRepo.LastRequestedAt(ctx, user.ID)
+	if err != nil {
+		logger.Error("Error checking reset requests", "error", err)
+		return
+	}
+	if last != nil && time.Since(*last) < s.policy.MinInterval {
+		return
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		logger.Error("Error generating reset token", "error", err)
+		return
+	}
+
+	record := &models.PasswordResetToken{
+		UserID:      user.ID,
+		TokenHash:   auth.HashSecretKey(token),
+		ExpiresAt:   time.Now().Add(s.policy.TokenTTL),
+		RequestedIP: clientIP,
+	}
+	if err := s.passwordResetRepo.Create(ctx, record); err != nil {
+		logger.Error("Error storing reset token", "error", err)
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your BartenderApp password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nsomeone asked to reset the password of your BartenderApp account. "+
+				"Open the link below to choose a new password. It is valid for %s and can be used once.\n\n%s\n\n"+
+				"If you did not ask for this, you can ignore this e-mail.\n",
+			user.Username, s.policy.TokenTTL, s.resetLink(token)),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		logger.Error("Error sending password reset mail", "error", err)
+	}
+}
+
+// Reset sets a new password with a token from a reset link. All sessions of
+// the user are revoked and any login lockout is cleared.
+func (s *PasswordResetService) Reset(ctx context.Context, token, newPassword string) error {
+	if token == "" {
+		return repository.ErrInvalidResetToken
+	}
+
+	tokenHash := auth.HashSecretKey(token)
+
+	userID, err := s.passwordResetRepo.GetUserID(ctx, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.Active {
+		return errAccountDeactivated
+	}
+
+	if err := s.passwordPolicy.checkNewPassword(ctx, s.userRepo, user, newPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.passwordResetRepo.ResetPassword(ctx, tokenHash, passwordHash); err != nil {
+		return err
+	}
+
+	// Sign out everywhere, the old password may have been compromised
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := s.denylist.RevokeUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	if err := s.loginGuard.Unlock(ctx, user.Username); err != nil {
+		logging.FromContext(ctx).Error("Error clearing failed logins", "error", err)
+	}
+
+	return nil
+}
+
+// resetLink builds the link to the frontend reset page
+func (s *PasswordResetService) resetLink(token string) string {
+	separator := "?"
+	if strings.Contains(s.policy.ResetURL, "?") {
+		separator = "&"
+	}
+	return s.policy.ResetURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// newLinkToken creates a random URL-safe token for links sent by e-mail
+func newLinkToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/metrics"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// PIN length limits
+const (
+	minPINLength = 4
+	maxPINLength = 8
+)
+
+// errPINLoginNotAllowed is returned for users who have to log in with their
+// password
+var errPINLoginNotAllowed = errors.New("log in with your password to continue")
+
+// PINPolicy configures quick PIN logins on terminals
+type PINPolicy struct {
+	// AllowedRoles are the roles that may log in with a PIN
+	AllowedRoles []string
+	// TokenTTL is the lifetime of tokens issued by a PIN login
+	TokenTTL time.Duration
+}
+
+// PINPolicyFromEnv builds a PINPolicy from environment variables
+func PINPolicyFromEnv() PINPolicy {
+	roles := []string{"bartender"}
+	if value := os.Getenv("PIN_LOGIN_ROLES"); value != "" {
+		roles = nil
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return PINPolicy{
+		AllowedRoles: roles,
+		TokenTTL:     envDuration("PIN_TOKEN_TTL", 15*time.Minute),
+	}
+}
+
+// PINService handles PIN management and PIN logins on registered terminals
+type PINService struct {
+	userRepo        *repository.UserRepository
+	roleRepo        *repository.RoleRepository
+	terminalService *TerminalService
+	signer          *auth.Signer
+	loginGuard      *LoginGuard
+	mfaService      *MFAService
+	policy          PINPolicy
+}
+
+// NewPINService creates a new PIN service
+func NewPINService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, terminalService *TerminalService, signer *auth.Signer, loginGuard *LoginGuard, mfaService *MFAService, policy PINPolicy) *PINService {
+	return &PINService{
+		userRepo:        userRepo,
+		roleRepo:        roleRepo,
+		terminalService: terminalService,
+		signer:          signer,
+		loginGuard:      loginGuard,
+		mfaService:      mfaService,
+		policy:          policy,
+	}
+}
+
+// Login authenticates a user with a PIN on a registered terminal. The token is
+// short-lived, bound to the terminal and comes without a refresh token; it is
+// refused for account and credential changes and revoked with the terminal.
+// Users who need a second factor or must change their password have to log
+// in with their password. Failures count towards the same lockout as password
+// logins.
+func (s *PINService) Login(ctx context.Context, terminalKey string, req models.PINLoginRequest, clientIP string) (*models.LoginResponse, error) {
+	// Only registered terminals accept PIN logins
+	terminal, err := s.terminalService.Authenticate(ctx, terminalKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find user by ID or username
+	var user *models.User
+	var lookupErr error
+	if req.UserID != 0 {
+		user, lookupErr = s.userRepo.GetByID(ctx, req.UserID)
+	} else {
+		user, lookupErr = s.userRepo.GetByUsername(ctx, req.Username)
+	}
+
+	// Failures of unknown users are tracked by what was sent
+	username := req.Username
+	if lookupErr == nil {
+		username = user.Username
+	} else if username == "" {
+		username = fmt.Sprintf("#%d", req.UserID)
+	}
+
+	// Refuse attempts while the username or client IP is throttled
+	if err := s.loginGuard.Reserve(ctx, username, clientIP); err != nil {
+		return nil, err
+	}
+
+	if lookupErr != nil {
+		s.loginGuard.RecordFailure(ctx, username, clientIP)
+		metrics.LoginFailed(metrics.LoginPIN)
+		return nil, errors.New("invalid credentials")
+	}
+
+	pinHash, err := s.userRepo.GetPINHash(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PIN: %w", err)
+	}
+
+	// Check PIN
+	if pinHash == "" || !s.allowed(user.Role) ||
+		!CheckPassword(pinHash, req.PIN) {
+		s.loginGuard.RecordFailure(ctx, username, clientIP)
+		metrics.LoginFailed(metrics.LoginPIN)
+		return nil, errors.New("invalid credentials")
+	}
+
+	// Deactivated users cannot log in
+	if !user.Active {
+		s.loginGuard.Release(ctx, username, clientIP)
+		metrics.LoginFailed(metrics.LoginPIN)
+		return nil, errAccountDeactivated
+	}
+
+	// A PIN cannot stand in for a second factor or a required password change
+	mfaEnabled, err := s.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+	if mfaEnabled || s.mfaService.Required(user) || user.PasswordChangeRequired {
+		s.loginGuard.Release(ctx, username, clientIP)
+		metrics.LoginFailed(metrics.LoginPIN)
+		return nil, errPINLoginNotAllowed
+	}
+
+	s.loginGuard.RecordSuccess(ctx, username, clientIP)
+	metrics.LoginSucceeded(metrics.LoginPIN)
+
+	permissions, err := s.roleRepo.GetPermissions(ctx, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+
+	token, err := s.signer.GenerateToken(*user, auth.TokenOptions{
+		Use:         auth.TokenUseTerminal,
+		AuthMethods: []string{"pin"},
+		TerminalID:  terminal.ID,
+		Permissions: permissions,
+		TTL:         s.policy.TokenTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return newLoginResponse(user, token, ""), nil
+}
+
+// SetPIN sets the PIN of the current user after checking their password
+func (s *PINService) SetPIN(ctx context.Context, claims *auth.Claims, currentPassword, pin string) error {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !CheckPassword(user.PasswordHash, currentPassword) {
+		return ErrIncorrectPassword
+	}
+
+	return s.setPIN(ctx, user, pin)
+}
+
+// RemovePIN removes the PIN of the current user
+func (s *PINService) RemovePIN(ctx context.Context, claims *auth.Claims) error {
+	return s.userRepo.SetPINHash(ctx, claims.UserID, "")
+}
+
+// SetUserPIN sets or, with an empty PIN, removes the PIN of another user
+func (s *PINService) SetUserPIN(ctx context.Context, userID int, pin string, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to set PINs of other users")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if pin == "" {
+		return s.userRepo.SetPINHash(ctx, user.ID, "")
+	}
+
+	return s.setPIN(ctx, user, pin)
+}
+
+// setPIN validates and stores a new PIN
+func (s *PINService) setPIN(ctx context.Context, user *models.User, pin string) error {
+	if !s.allowed(user.Role) {
+		return fmt.Errorf("users with role %s cannot log in with a PIN", user.Role)
+	}
+
+	if err := validatePIN(pin); err != nil {
+		return err
+	}
+
+	pinHash, err := HashPassword(pin)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.SetPINHash(ctx, user.ID, pinHash)
+}
+
+// allowed reports whether users with a role may log in with a PIN
+func (s *PINService) allowed(role string) bool {
+	for _, allowedRole := range s.policy.AllowedRoles {
+		if role == allowedRole {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePIN checks that a PIN consists of 4 to 8 digits
+func validatePIN(pin string) error {
+	if len(pin) < minPINLength || len(pin) > maxPINLength {
+		return fmt.Errorf("PIN must have %d to %d digits", minPINLength, maxPINLength)
+	}
+
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return errors.New("PIN must only contain digits")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+var (
+	// roleNamePattern matches role names such as "bar_manager"
+	roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+	// permissionNamePattern matches permission names such as "orders:refund"
+	permissionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(:[a-z][a-z0-9_]*)+$`)
+)
+
+// RoleService manages roles and the permissions they grant
+type RoleService struct {
+	roleRepo *repository.RoleRepository
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(roleRepo *repository.RoleRepository) *RoleService {
+	return &RoleService{
+		roleRepo: roleRepo,
+	}
+}
+
+// List retrieves all roles and their permissions
+func (s *RoleService) List(ctx context.Context, claims *auth.Claims) ([]models.Role, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage, auth.PermUsersWrite) {
+		return nil, errors.New("missing permission to list roles")
+	}
+
+	return s.roleRepo.List(ctx)
+}
+
+// Create adds a new role
+func (s *RoleService) Create(ctx context.Context, role *models.Role, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage) {
+		return errors.New("missing permission to manage roles")
+	}
+
+	if !roleNamePattern.MatchString(role.Name) {
+		return errors.New("role name must consist of lowercase letters, digits and underscores")
+	}
+
+	permissions, err := s.normalizePermissions(ctx, role.Permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+
+	return s.roleRepo.Create(ctx, role)
+}
+
+// Update changes the description and permissions of a role
+func (s *RoleService) Update(ctx context.Context, role *models.Role, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage) {
+		return errors.New("missing permission to manage roles")
+	}
+
+	permissions, err := s.normalizePermissions(ctx, role.Permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+
+	// Keep at least one role able to manage roles
+	if role.Name == "admin" && !containsString(permissions, auth.PermRolesManage) {
+		return fmt.Errorf("the admin role must keep the %s permission", auth.PermRolesManage)
+	}
+
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return err
+	}
+
+	updated, err := s.roleRepo.GetByName(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	*role = *updated
+
+	return nil
+}
+
+// Delete removes a role that is no longer assigned to any user
+func (s *RoleService) Delete(ctx context.Context, name string, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage) {
+		return errors.New("missing permission to manage roles")
+	}
+
+	return s.roleRepo.Delete(ctx, name)
+}
+
+// ListPermissions retrieves all permissions
+func (s *RoleService) ListPermissions(ctx context.Context, claims *auth.Claims) ([]models.Permission, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage, auth.PermAPIClientsManage) {
+		return nil, errors.New("missing permission to list permissions")
+	}
+
+	return s.roleRepo.ListPermissions(ctx)
+}
+
+// CreatePermission adds a new permission, e.g. for a new service
+func (s *RoleService) CreatePermission(ctx context.Context, permission *models.Permission, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermRolesManage) {
+		return errors.New("missing permission to manage roles")
+	}
+
+	if !permissionNamePattern.MatchString(permission.Name) {
+		return errors.New("permission name must have the form resource:action")
+	}
+
+	return s.roleRepo.CreatePermission(ctx, permission)
+}
+
+// normalizePermissions sorts and deduplicates permission names and checks that they exist
+func (s *RoleService) normalizePermissions(ctx context.Context, permissions []string) ([]string, error) {
+	normalized, err := validatePermissions(ctx, s.roleRepo, permissions)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// validatePermissions trims and deduplicates permission names and checks that they exist
+func validatePermissions(ctx context.Context, roleRepo *repository.RoleRepository, permissions []string) ([]string, error) {
+	seen := make(map[string]bool, len(permissions))
+	normalized := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+
+	unknown, err := roleRepo.UnknownPermissions(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown permissions: %s", strings.Join(unknown, ", "))
+	}
+
+	return normalized, nil
+}
+
+// canGrant reports whether the claims may hand out the given permissions,
+// either by holding all of them or by being allowed to manage roles
+func canGrant(claims *auth.Claims, permissions []string) bool {
+	if auth.HasPermission(claims, auth.PermRolesManage) {
+		return true
+	}
+
+	for _, permission := range permissions {
+		if !auth.HasPermission(claims, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString reports whether a slice contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// maxDeviceNameLength bounds the device names clients can send
+const maxDeviceNameLength = 100
+
+// SessionIDPattern matches session IDs, which are UUIDs in the lowercase form
+// the database returns them in. Routes use it to restrict session_id.
+const SessionIDPattern = `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+
+// sessionIDFormat checks session IDs before they reach the database, which
+// would reject malformed ones with an error
+var sessionIDFormat = regexp.MustCompile(`^` + SessionIDPattern + `$`)
+
+// ErrSessionNotFound is returned for sessions that do not exist, belong to
+// another user or have already ended
+var ErrSessionNotFound = repository.ErrSessionNotFound
+
+// SessionService lists and ends the sessions of users on their devices
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+	userRepo    *repository.UserRepository
+	recorder    audit.Recorder
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(sessionRepo *repository.SessionRepository, userRepo *repository.UserRepository, recorder audit.Recorder) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		recorder:    recorder,
+	}
+}
+
+// List returns the active sessions of a user and marks the one the claims
+// belong to. Users can list their own; other users require users:security.
+func (s *SessionService) List(ctx context.Context, userID int, claims *auth.Claims) ([]models.Session, error) {
+	// Check permissions
+	if claims.UserID != userID && !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return nil, errors.New("missing permission to view sessions")
+	}
+
+	// Make sure the user exists
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	return sessions, nil
+}
+
+// Revoke signs a session out, e.g. a forgotten tablet. Users can end their
+// own sessions; other users require users:security.
+func (s *SessionService) Revoke(ctx context.Context, userID int, sessionID string, claims *auth.Claims) error {
+	// Check permissions
+	if claims.UserID != userID && !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return errors.New("missing permission to revoke sessions")
+	}
+
+	if !sessionIDFormat.MatchString(sessionID) {
+		return ErrSessionNotFound
+	}
+
+	if err := s.sessionRepo.Revoke(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(userID),
+		Changes: map[string]audit.Change{
+			"session_id": {From: sessionID, To: nil},
+		},
+	})
+
+	return nil
+}
+
+// sessionDeviceName returns the device name given at login, or a name such
+// as "Firefox on Android" derived from the user agent
+func sessionDeviceName(deviceName, userAgent string) string {
+	if deviceName = strings.TrimSpace(deviceName); deviceName != "" {
+		if runes := []rune(deviceName); len(runes) > maxDeviceNameLength {
+			deviceName = string(runes[:maxDeviceNameLength])
+		}
+		return deviceName
+	}
+
+	// Order matters: Edge and Chrome also claim to be Safari, iOS to be macOS
+	browser := firstMatch(userAgent, [][2]string{
+		{"Edg/", "Edge"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	})
+	platform := firstMatch(userAgent, [][2]string{
+		{"Android", "Android"},
+		{"iPad", "iPadOS"},
+		{"iPhone", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	default:
+		return platform
+	}
+}
+
+// firstMatch returns the name of the first token contained in s
+func firstMatch(s string, tokens [][2]string) string {
+	for _, token := range tokens {
+		if strings.Contains(s, token[0]) {
+			return token[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+)
+
+func TestSessionIDFormat(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f2c9a4e-8b1d-4c6f-9e2a-7d5b1c0e4f8a", true},
+		{"3F2C9A4E-8B1D-4C6F-9E2A-7D5B1C0E4F8A", false},
+		{"3f2c9a4e8b1d4c6f9e2a7d5b1c0e4f8a", false},
+		{"3f2c9a4e-8b1d-4c6f-9e2a-7d5b1c0e4f8", false},
+		{"3f2c9a4e-8b1d-4c6f-9e2a-7d5b1c0e4f8a0", false},
+		{"----", false},
+		{"abc", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := sessionIDFormat.MatchString(tt.id); got != tt.want {
+				t.Errorf("sessionIDFormat.MatchString(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeRejectsMalformedSessionIDs(t *testing.T) {
+	// Without a repository, reaching the database would panic
+	s := &SessionService{}
+	claims := &auth.Claims{UserID: 7}
+
+	for _, id := range []string{"abc", "----", "3f2c9a4e-8b1d"} {
+		if err := s.Revoke(context.Background(), 7, id, claims); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Revoke(%q) error = %v, want %v", id, err, ErrSessionNotFound)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// terminalKeyKind is the leading part of every terminal key
+const terminalKeyKind = "term"
+
+// errInvalidTerminal is returned for unknown, malformed or revoked terminal keys
+var errInvalidTerminal = errors.New("invalid terminal key")
+
+// TerminalService manages the POS terminals that accept PIN logins
+type TerminalService struct {
+	terminalRepo *repository.TerminalRepository
+}
+
+// NewTerminalService creates a new terminal service
+func NewTerminalService(terminalRepo *repository.TerminalRepository) *TerminalService {
+	return &TerminalService{
+		terminalRepo: terminalRepo,
+	}
+}
+
+// List retrieves all registered terminals
+func (s *TerminalService) List(ctx context.Context, claims *auth.Claims) ([]models.Terminal, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermTerminalsManage) {
+		return nil, errors.New("missing permission to list terminals")
+	}
+
+	return s.terminalRepo.List(ctx)
+}
+
+// Register adds a new terminal. The returned terminal carries its key, which
+// is not stored and cannot be retrieved again.
+func (s *TerminalService) Register(ctx context.Context, name string, claims *auth.Claims) (*models.Terminal, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermTerminalsManage) {
+		return nil, errors.New("missing permission to register terminals")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("terminal name is required")
+	}
+
+	key, prefix, hash, err := auth.NewSecretKey(terminalKeyKind)
+	if err != nil {
+		return nil, err
+	}
+
+	createdBy := claims.UserID
+	terminal := &models.Terminal{
+		Name:      name,
+		KeyPrefix: prefix,
+		KeyHash:   hash,
+		CreatedBy: &createdBy,
+	}
+
+	if err := s.terminalRepo.Create(ctx, terminal); err != nil {
+		return nil, err
+	}
+
+	terminal.Key = key
+	return terminal, nil
+}
+
+// Revoke disables a terminal so that it no longer accepts PIN logins
+func (s *TerminalService) Revoke(ctx context.Context, id int, claims *auth.Claims) error {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermTerminalsManage) {
+		return errors.New("missing permission to revoke terminals")
+	}
+
+	return s.terminalRepo.Revoke(ctx, id)
+}
+
+// Authenticate returns the active terminal a key belongs to
+func (s *TerminalService) Authenticate(ctx context.Context, key string) (*models.Terminal, error) {
+	prefix, ok := auth.ParseSecretKey(terminalKeyKind, key)
+	if !ok {
+		return nil, errInvalidTerminal
+	}
+
+	terminal, err := s.terminalRepo.GetByKeyPrefix(ctx, prefix)
+	if err != nil {
+		return nil, errInvalidTerminal
+	}
+
+	if terminal.RevokedAt != nil || !auth.SecretKeyMatches(key, terminal.KeyHash) {
+		return nil, errInvalidTerminal
+	}
+
+	if err := s.terminalRepo.TouchLastSeen(ctx, terminal.ID); err != nil {
+		logging.FromContext(ctx).Error("Error updating terminal last seen", "terminal_id", terminal.ID, "error", err)
+	}
+
+	return terminal, nil
+}
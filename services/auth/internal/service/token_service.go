@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// OAuth error codes (RFC 6749 section 5.2 and RFC 8707)
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthInvalidTarget        = "invalid_target"
+)
+
+// OAuthError is an error of the OAuth token endpoint
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// ClientTokenPolicy configures the tokens issued to machine clients
+type ClientTokenPolicy struct {
+	// TTL is the lifetime of client credentials tokens
+	TTL time.Duration
+}
+
+// ClientTokenPolicyFromEnv loads the client token policy from the environment
+func ClientTokenPolicyFromEnv() ClientTokenPolicy {
+	return ClientTokenPolicy{
+		TTL: envDuration("CLIENT_TOKEN_TTL", 15*time.Minute),
+	}
+}
+
+// TokenService issues tokens to machine clients and introspects tokens for
+// other services
+type TokenService struct {
+	apiClientRepo    *repository.APIClientRepository
+	refreshTokenRepo *repository.RefreshTokenRepository
+	userRepo         *repository.UserRepository
+	signer           *auth.Signer
+	policy           ClientTokenPolicy
+}
+
+// NewTokenService creates a new token service
+func NewTokenService(apiClientRepo *repository.APIClientRepository, refreshTokenRepo *repository.RefreshTokenRepository, userRepo *repository.UserRepository, signer *auth.Signer, policy ClientTokenPolicy) *TokenService {
+	return &TokenService{
+		apiClientRepo:    apiClientRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		userRepo:         userRepo,
+		signer:           signer,
+		policy:           policy,
+	}
+}
+
+// ClientCredentials issues a short-lived access token with the client
+// credentials grant. The client authenticates with its ID and API key and
+// names the service it wants to call, which must be one of its audiences.
+// The token carries the requested scopes, or all scopes of the client.
+func (s *TokenService) ClientCredentials(ctx context.Context, clientID, clientSecret, scope, audience string) (*models.ClientTokenResponse, error) {
+	id, err := strconv.Atoi(clientID)
+	if err != nil || clientSecret == "" {
+		return nil, &OAuthError{Code: OAuthInvalidClient, Description: "client authentication failed"}
+	}
+
+	// The secret is the API key of the client
+	claims, err := auth.ValidateAPIKey(ctx, clientSecret)
+	if err != nil || claims.ClientID != id {
+		return nil, &OAuthError{Code: OAuthInvalidClient, Description: "client authentication failed"}
+	}
+
+	client, err := s.apiClientRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, &OAuthError{Code: OAuthInvalidClient, Description: "client authentication failed"}
+	}
+
+	if audience == "" {
+		return nil, &OAuthError{Code: OAuthInvalidRequest, Description: "audience is required"}
+	}
+	if !containsString(client.Audiences, audience) {
+		return nil, &OAuthError{Code: OAuthInvalidTarget, Description: "client may not request tokens for this audience"}
+	}
+
+	scopes := client.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !containsString(client.Scopes, s) {
+				return nil, &OAuthError{Code: OAuthInvalidScope, Description: fmt.Sprintf("scope %q is not granted to this client", s)}
+			}
+		}
+		scopes = requested
+	}
+
+	// Never outlive the API key the token was issued for
+	ttl := s.policy.TTL
+	if client.ExpiresAt != nil {
+		if remaining := time.Until(*client.ExpiresAt); remaining < ttl {
+			ttl = remaining
+		}
+	}
+
+	token, err := s.signer.GenerateClientToken(auth.ClientTokenOptions{
+		ClientID: client.ID,
+		Name:     client.Name,
+		Scopes:   scopes,
+		Audience: audience,
+		TTL:      ttl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &models.ClientTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Introspect reports whether an access token, API key or refresh token is
+// active (RFC 7662). Tokens that are unknown, expired, revoked or malformed
+// are reported as inactive without further detail.
+func (s *TokenService) Introspect(ctx context.Context, token string, claims *auth.Claims) (*auth.Introspection, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermTokensIntrospect) {
+		return nil, errors.New("missing permission to introspect tokens")
+	}
+
+	inactive := &auth.Introspection{Active: false}
+	if token == "" {
+		return inactive, nil
+	}
+
+	// API keys
+	if _, ok := auth.ParseSecretKey(auth.APIKeyKind, token); ok {
+		keyClaims, err := auth.ValidateAPIKey(ctx, token)
+		if err != nil {
+			return inactive, nil
+		}
+		return auth.NewIntrospection(keyClaims, auth.TokenTypeAPIKey), nil
+	}
+
+	// JWT access tokens of users and machine clients
+	if strings.Count(token, ".") == 2 {
+		tokenClaims, err := auth.ParseToken(ctx, token)
+		if err != nil {
+			return inactive, nil
+		}
+		return auth.NewIntrospection(tokenClaims, auth.TokenTypeAccess), nil
+	}
+
+	return s.introspectRefreshToken(ctx, token)
+}
+
+// introspectRefreshToken describes an opaque refresh token
+func (s *TokenService) introspectRefreshToken(ctx context.Context, token string) (*auth.Introspection, error) {
+	inactive := &auth.Introspection{Active: false}
+
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashRefreshToken(token))
+	if err != nil || stored.RevokedAt != nil || stored.RotatedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return inactive, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil || !user.Active {
+		return inactive, nil
+	}
+
+	return auth.NewIntrospection(&auth.Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: stored.FamilyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "bartenderapp",
+			Subject:   strconv.Itoa(user.ID),
+			ExpiresAt: jwt.NewNumericDate(stored.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(stored.CreatedAt),
+		},
+	}, auth.TokenTypeRefresh), nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the RFC 6238 test vectors,
+// "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(rfc6238Secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	code := func(step int64) string {
+		c, err := totpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, code(current), current, true},
+		{"previous step", rfc6238Secret, code(current - 1), current - 1, true},
+		{"next step", rfc6238Secret, code(current + 1), current + 1, true},
+		{"surrounding spaces", rfc6238Secret, " " + code(current) + " ", current, true},
+		{"outside skew", rfc6238Secret, code(current - 2), 0, false},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"too short", rfc6238Secret, code(current)[:5], 0, false},
+		{"empty", rfc6238Secret, "", 0, false},
+		{"invalid secret", "not base32!", code(current), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := verifyTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("verifyTOTP() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// Page sizes of user lists
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidUserFilter is returned for user lists with an unknown sort field or status
+var ErrInvalidUserFilter = repository.ErrInvalidUserFilter
+
+// userCursor is the opaque next_cursor of user lists. It records the sort
+// order, so a cursor cannot be used with a different one.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// encodeUserCursor returns the cursor that continues a list after user
+func encodeUserCursor(sort string, desc bool, user models.User) string {
+	position := userPosition(sort, user)
+	data, _ := json.Marshal(userCursor{Sort: sort, Desc: desc, Value: position.Value, ID: user.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// userPosition returns the position of user in a list sorted by sort
+func userPosition(sort string, user models.User) *models.UserCursor {
+	var value string
+	switch sort {
+	case "email":
+		value = user.Email
+	case "role":
+		value = user.Role
+	case "created_at":
+		value = user.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		value = user.Username
+	}
+
+	return &models.UserCursor{Value: value, ID: user.ID}
+}
+
+// decodeUserCursor parses a cursor and checks that it belongs to the sort order
+func decodeUserCursor(cursor, sort string, desc bool) (*models.UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+
+	return &models.UserCursor{Value: c.Value, ID: c.ID}, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+func TestDecodeUserCursor(t *testing.T) {
+	user := models.User{ID: 7, Username: "ana", Email: "ana@example.com", CreatedAt: time.Unix(1700000000, 0)}
+	byName := encodeUserCursor("username", false, user)
+
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		desc    bool
+		want    *models.UserCursor
+		wantErr error
+	}{
+		{"same order", byName, "username", false, &models.UserCursor{Value: "ana", ID: 7}, nil},
+		{"other sort", byName, "email", false, nil, ErrInvalidCursor},
+		{"other direction", byName, "username", true, nil, ErrInvalidCursor},
+		{"not base64", "%%%", "username", false, nil, ErrInvalidCursor},
+		{"not json", "bm90IGpzb24", "username", false, nil, ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUserCursor(tt.cursor, tt.sort, tt.desc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeUserCursor() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && (got == nil || *got != *tt.want) {
+				t.Errorf("decodeUserCursor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
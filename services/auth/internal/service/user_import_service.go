@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/csvutil"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// maxImportRows bounds the number of users in one CSV import. The rows are
+// checked against the database and their passwords hashed while the request
+// waits, which has to fit well within the 15 second write timeout.
+const maxImportRows = 100
+
+// ErrImportRejected is returned when rows of an import are invalid. Nothing
+// is stored then; the result lists the errors per row.
+var ErrImportRejected = errors.New("the import has invalid rows, no users were imported")
+
+// UserCSVHeader is the header row of user CSV exports. Imports read the
+// username, email and role columns plus password or invite and ignore the rest,
+// so an export can be edited and imported elsewhere.
+var UserCSVHeader = []string{"id", "username", "email", "role", "active", "created_at", "deactivated_at"}
+
+// UserCSVRecord returns a user as a CSV row matching UserCSVHeader. Cells
+// users can choose are escaped so they cannot run spreadsheet formulas.
+func UserCSVRecord(user models.User) []string {
+	deactivatedAt := ""
+	if user.DeactivatedAt != nil {
+		deactivatedAt = user.DeactivatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		strconv.Itoa(user.ID),
+		csvutil.Escape(user.Username),
+		csvutil.Escape(user.Email),
+		csvutil.Escape(user.Role),
+		strconv.FormatBool(user.Active),
+		user.CreatedAt.UTC().Format(time.RFC3339),
+		deactivatedAt,
+	}
+}
+
+// importRow is one user of a CSV import
+type importRow struct {
+	line     int
+	username string
+	email    string
+	role     string
+	password string
+	invite   bool
+
+	// err is a problem found while reading the row
+	err error
+}
+
+// UserImportService creates users in bulk from CSV files
+type UserImportService struct {
+	userRepo          *repository.UserRepository
+	invitationRepo    *repository.InvitationRepository
+	userService       *UserService
+	invitationService *InvitationService
+}
+
+// NewUserImportService creates a new user import service
+func NewUserImportService(userRepo *repository.UserRepository, invitationRepo *repository.InvitationRepository, userService *UserService, invitationService *InvitationService) *UserImportService {
+	return &UserImportService{
+		userRepo:          userRepo,
+		invitationRepo:    invitationRepo,
+		userService:       userService,
+		invitationService: invitationService,
+	}
+}
+
+// Import reads users from CSV with the columns username, email, role and
+// either password or invite. Rows with a password become users right away and
+// must change the password at their first login, rows with invite set to yes
+// get an invitation mail and the invitee chooses the username. Every row is
+// checked with the rules of UserService.Create first; if any row is invalid
+// nothing is stored and ErrImportRejected is returned with the errors per row.
+// Otherwise all rows are stored in one transaction. With dryRun the rows are
+// only checked.
+func (s *UserImportService) Import(ctx context.Context, r io.Reader, dryRun bool, claims *auth.Claims) (*models.UserImportResult, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return nil, errors.New("missing permission to import users")
+	}
+
+	rows, err := parseImportCSV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.UserImportResult{
+		DryRun: dryRun,
+		Rows:   len(rows),
+		Errors: []models.UserImportError{},
+	}
+
+	s.validate(ctx, rows, claims, result)
+
+	if len(result.Errors) > 0 {
+		if dryRun {
+			return result, nil
+		}
+		return result, ErrImportRejected
+	}
+
+	// A dry run reports what the import would do
+	if dryRun {
+		for _, row := range rows {
+			if row.invite {
+				result.Invited++
+			} else {
+				result.Created++
+			}
+		}
+		return result, nil
+	}
+
+	var users []*models.User
+	var invitations []*models.Invitation
+	tokens := map[*models.Invitation]string{}
+
+	for _, row := range rows {
+		if row.invite {
+			token, err := newLinkToken()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate invite token: %w", err)
+			}
+
+			invitedBy := claims.UserID
+			invitation := &models.Invitation{
+				Email:     row.email,
+				Role:      row.role,
+				TokenHash: auth.HashSecretKey(token),
+				InvitedBy: &invitedBy,
+				ExpiresAt: time.Now().Add(s.invitationService.policy.TokenTTL),
+			}
+			invitations = append(invitations, invitation)
+			tokens[invitation] = token
+			continue
+		}
+
+		hashedPassword, err := HashPassword(row.password)
+		if err != nil {
+			return nil, err
+		}
+
+		// The importer knows the password, so the user replaces it
+		users = append(users, &models.User{
+			Username:               row.username,
+			Email:                  row.email,
+			Role:                   row.role,
+			PasswordHash:           hashedPassword,
+			PasswordChangeRequired: true,
+		})
+	}
+
+	if err := s.userRepo.Import(ctx, users, invitations); err != nil {
+		return nil, fmt.Errorf("failed to import users: %w", err)
+	}
+
+	result.Created = len(users)
+	result.Invited = len(invitations)
+
+	for _, user := range users {
+		// Don't return password hash
+		user.PasswordHash = ""
+		s.userService.recordCreated(ctx, user, claims)
+		result.Users = append(result.Users, *user)
+	}
+
+	for _, invitation := range invitations {
+		s.invitationService.send(ctx, invitation, tokens[invitation], claims.Username)
+		result.Invitations = append(result.Invitations, *invitation)
+	}
+
+	return result, nil
+}
+
+// validate checks every row and adds an error to result for each invalid
+// row. Besides the rules for new users it rejects rows that repeat the
+// username or e-mail address of an earlier row.
+func (s *UserImportService) validate(ctx context.Context, rows []importRow, claims *auth.Claims, result *models.UserImportResult) {
+	roleErrors := map[string]error{}
+	usernames := map[string]int{}
+	emails := map[string]int{}
+
+	for _, row := range rows {
+		username, email := strings.ToLower(row.username), strings.ToLower(row.email)
+
+		err := s.validateRow(ctx, row, claims, roleErrors)
+		if line, ok := usernames[username]; err == nil && username != "" && ok {
+			err = fmt.Errorf("username is already used on line %d", line)
+		}
+		if line, ok := emails[email]; err == nil && ok {
+			err = fmt.Errorf("email is already used on line %d", line)
+		}
+
+		// Remember where a username or address is used first
+		if _, ok := usernames[username]; !ok && username != "" {
+			usernames[username] = row.line
+		}
+		if _, ok := emails[email]; !ok {
+			emails[email] = row.line
+		}
+
+		if err != nil {
+			result.Errors = append(result.Errors, models.UserImportError{
+				Line:     row.line,
+				Username: row.username,
+				Email:    row.email,
+				Error:    err.Error(),
+			})
+		}
+	}
+}
+
+// validateRow checks a single row against the rules for new users and
+// invitations. Role checks are cached in roleErrors.
+func (s *UserImportService) validateRow(ctx context.Context, row importRow, claims *auth.Claims, roleErrors map[string]error) error {
+	if row.err != nil {
+		return row.err
+	}
+
+	if row.invite {
+		if row.password != "" {
+			return errors.New("set either a password or invite, not both")
+		}
+		if row.username != "" {
+			return errors.New("invited users choose their username, leave it empty")
+		}
+		if !strings.Contains(row.email, "@") {
+			return errors.New("invalid email format")
+		}
+	} else {
+		if row.password == "" {
+			return errors.New("a password or invite is required")
+		}
+		if row.username == "" {
+			return errors.New("username is required")
+		}
+		if err := s.userService.validateNewUser(&models.User{Email: row.email, PasswordHash: row.password}); err != nil {
+			return err
+		}
+	}
+
+	// Validate role and make sure it grants nothing the importer does not have
+	roleErr, ok := roleErrors[row.role]
+	if !ok {
+		roleErr = s.userService.checkAssignableRole(ctx, row.role, claims)
+		roleErrors[row.role] = roleErr
+	}
+	if roleErr != nil {
+		return roleErr
+	}
+
+	if row.username != "" {
+		if _, err := s.userRepo.GetByUsername(ctx, row.username); err == nil {
+			return errors.New("username already exists")
+		}
+	}
+
+	if _, err := s.userRepo.GetByEmail(ctx, row.email); err == nil {
+		return errors.New("a user with this email already exists")
+	}
+
+	if row.invite {
+		open, err := s.invitationRepo.HasOpen(ctx, row.email)
+		if err != nil {
+			return fmt.Errorf("failed to check invitations: %w", err)
+		}
+		if open {
+			return errors.New("the address already has an open invitation")
+		}
+	}
+
+	return nil
+}
+
+// parseImportCSV reads the rows of an import. The header row names the
+// columns; username, email and role are required, password and invite are
+// optional and unknown columns are ignored. Cells escaped by an export are
+// read back as they were.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet programs may start the file with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+
+	for _, name := range []string{"username", "email", "role"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV header has no %s column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return csvutil.Unescape(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("the CSV file has more than %d rows", maxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := importRow{
+			line:     line,
+			username: field(record, "username"),
+			email:    field(record, "email"),
+			role:     field(record, "role"),
+			password: field(record, "password"),
+		}
+
+		switch value := strings.ToLower(field(record, "invite")); value {
+		case "", "no", "false", "0":
+		case "yes", "true", "1":
+			row.invite = true
+		default:
+			row.err = fmt.Errorf("invalid invite value %q, expected yes or no", value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("the CSV file has no rows")
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []importRow
+		wantErr string
+	}{
+		{
+			name: "password and invite rows",
+			csv:  "username,email,role,password,invite\nana,ana@example.com,bartender,Secret-123,\n,bo@example.com,manager,,yes\n",
+			want: []importRow{
+				{line: 2, username: "ana", email: "ana@example.com", role: "bartender", password: "Secret-123"},
+				{line: 3, email: "bo@example.com", role: "manager", invite: true},
+			},
+		},
+		{
+			name: "byte order mark and unknown columns",
+			csv:  "\ufeffUsername, email ,role,id\nana,ana@example.com,bartender,7\n",
+			want: []importRow{{line: 2, username: "ana", email: "ana@example.com", role: "bartender"}},
+		},
+		{
+			name: "escaped export cells",
+			csv:  "username,email,role\n'=ana,'-ana@example.com,bartender\n",
+			want: []importRow{{line: 2, username: "=ana", email: "-ana@example.com", role: "bartender"}},
+		},
+		{name: "empty file", csv: "", wantErr: "the CSV file is empty"},
+		{name: "no rows", csv: "username,email,role\n", wantErr: "the CSV file has no rows"},
+		{name: "missing column", csv: "username,email\nana,ana@example.com\n", wantErr: "no role column"},
+		{name: "ragged row", csv: "username,email,role\nana,ana@example.com\n", wantErr: "invalid CSV"},
+		{
+			name:    "too many rows",
+			csv:     "username,email,role\n" + strings.Repeat("ana,ana@example.com,bartender\n", maxImportRows+1),
+			wantErr: "more than 100 rows",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseImportCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseImportCSV() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("parseImportCSV() = %+v, want %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportCSVInviteValues(t *testing.T) {
+	tests := []struct {
+		value   string
+		invite  bool
+		invalid bool
+	}{
+		{"", false, false},
+		{"no", false, false},
+		{"FALSE", false, false},
+		{"yes", true, false},
+		{"1", true, false},
+		{"maybe", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			rows, err := parseImportCSV(strings.NewReader("username,email,role,invite\n,ana@example.com,bartender," + tt.value + "\n"))
+			if err != nil {
+				t.Fatalf("parseImportCSV() error = %v", err)
+			}
+			if rows[0].invite != tt.invite || (rows[0].err != nil) != tt.invalid {
+				t.Errorf("invite = %v, err = %v; want invite %v, invalid %v", rows[0].invite, rows[0].err, tt.invite, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestUserCSVRecordEscapesFormulas(t *testing.T) {
+	user := models.User{
+		ID:        7,
+		Username:  "=HYPERLINK(\"http://evil\")",
+		Email:     "@ana@example.com",
+		Role:      "bartender",
+		Active:    true,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	want := []string{"7", "'=HYPERLINK(\"http://evil\")", "'@ana@example.com", "bartender", "true", "2024-01-02T03:04:05Z", ""}
+	if got := UserCSVRecord(user); !reflect.DeepEqual(got, want) {
+		t.Errorf("UserCSVRecord() = %q, want %q", got, want)
+	}
+}
@@ -1,29 +1,47 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ignaseim/bartenderapp/services/auth/internal/repository"
+	"github.com/ignaseim/bartenderapp/services/pkg/audit"
 	"github.com/ignaseim/bartenderapp/services/pkg/auth"
 	"github.com/ignaseim/bartenderapp/services/pkg/models"
 )
 
+// ErrIncorrectPassword is returned when the current password does not match
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
 // UserService handles user-related operations
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo         *repository.UserRepository
+	roleRepo         *repository.RoleRepository
+	refreshTokenRepo *repository.RefreshTokenRepository
+	denylist         *auth.SQLDenylist
+	passwordPolicy   PasswordPolicy
+	recorder         audit.Recorder
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo *repository.UserRepository) *UserService {
+func NewUserService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, refreshTokenRepo *repository.RefreshTokenRepository, denylist *auth.SQLDenylist, passwordPolicy PasswordPolicy, recorder audit.Recorder) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		denylist:         denylist,
+		passwordPolicy:   passwordPolicy,
+		recorder:         recorder,
 	}
 }
 
 // GetByID retrieves a user by ID
-func (s *UserService) GetByID(id int) (*models.User, error) {
-	user, err := s.userRepo.GetByID(id)
+func (s *UserService) GetByID(ctx context.Context, id int) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +52,8 @@ func (s *UserService) GetByID(id int) (*models.User, error) {
 }
 
 // GetCurrentUser gets the currently authenticated user
-func (s *UserService) GetCurrentUser(claims *auth.Claims) (*models.User, error) {
-	user, err := s.userRepo.GetByID(claims.UserID)
+func (s *UserService) GetCurrentUser(ctx context.Context, claims *auth.Claims) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -45,36 +63,105 @@ func (s *UserService) GetCurrentUser(claims *auth.Claims) (*models.User, error)
 	return user, nil
 }
 
-// List retrieves all users, optionally filtered by role
-func (s *UserService) List(role string) ([]models.User, error) {
-	users, err := s.userRepo.List(role)
+// List retrieves one page of users. A page is selected either with
+// q.Offset or with the next_cursor of the previous page.
+func (s *UserService) List(ctx context.Context, q models.UserListQuery, cursor string) (*models.UserPage, error) {
+	if q.Sort == "" {
+		q.Sort = "username"
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultUserPageSize
+	}
+	if q.Limit > maxUserPageSize {
+		q.Limit = maxUserPageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeUserCursor(cursor, q.Sort, q.Desc)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+		q.Offset = 0
+	}
+
+	total, err := s.userRepo.Count(ctx, q)
 	if err != nil {
 		return nil, err
 	}
 
-	// Don't return password hashes
-	for i := range users {
-		users[i].PasswordHash = ""
+	// Fetch one more user to find out whether there is a next page
+	limit := q.Limit
+	q.Limit++
+	users, err := s.userRepo.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  limit,
+		Offset: q.Offset,
+	}
+
+	if len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = encodeUserCursor(q.Sort, q.Desc, last)
 	}
 
-	return users, nil
+	return page, nil
 }
 
-// Create adds a new user
-func (s *UserService) Create(user *models.User, claims *auth.Claims) error {
-	// Validate role
-	if !isValidRole(user.Role) {
-		return errors.New("invalid role")
+// Export passes all users matching the filters of q to fn in the order of
+// q.Sort. Users are loaded in batches, so exports of many users do not have
+// to fit in memory.
+func (s *UserService) Export(ctx context.Context, q models.UserListQuery, fn func(models.User) error) error {
+	if q.Sort == "" {
+		q.Sort = "username"
 	}
+	q.Limit = maxUserPageSize
+	q.Offset = 0
+	q.After = nil
 
-	// Only admins can create other admin users
-	if user.Role == "admin" && (claims == nil || claims.Role != "admin") {
-		return errors.New("only admins can create admin users")
+	for {
+		users, err := s.userRepo.List(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < q.Limit {
+			return nil
+		}
+
+		q.After = userPosition(q.Sort, users[len(users)-1])
 	}
+}
 
-	// Validate email format (basic check)
-	if !strings.Contains(user.Email, "@") {
-		return errors.New("invalid email format")
+// Create adds a new user
+func (s *UserService) Create(ctx context.Context, user *models.User, claims *auth.Claims) error {
+	// Validate role and make sure it grants nothing the creator does not have
+	if err := s.checkAssignableRole(ctx, user.Role, claims); err != nil {
+		return err
+	}
+
+	return s.create(ctx, user, claims, s.userRepo.Create)
+}
+
+// create applies the rules for new users, hashes the plaintext password in
+// user.PasswordHash and stores the user with insert. Without claims the new
+// user is recorded as having created themselves.
+func (s *UserService) create(ctx context.Context, user *models.User, claims *auth.Claims, insert func(context.Context, *models.User) error) error {
+	if err := s.validateNewUser(user); err != nil {
+		return err
 	}
 
 	// Hash password
@@ -85,96 +172,320 @@ func (s *UserService) Create(user *models.User, claims *auth.Claims) error {
 	user.PasswordHash = hashedPassword
 
 	// Create user
-	err = s.userRepo.Create(user)
+	err = insert(ctx, user)
 	if err != nil {
 		return err
 	}
 
 	// Don't return password hash
 	user.PasswordHash = ""
+
+	s.recordCreated(ctx, user, claims)
+
 	return nil
 }
 
-// Update updates an existing user
-func (s *UserService) Update(user *models.User, claims *auth.Claims) error {
+// validateNewUser checks the e-mail address of a new user and the plaintext
+// password in user.PasswordHash
+func (s *UserService) validateNewUser(user *models.User) error {
+	// Validate email format (basic check)
+	if !strings.Contains(user.Email, "@") {
+		return errors.New("invalid email format")
+	}
+
+	// Check password policy
+	return s.passwordPolicy.Validate(user.PasswordHash)
+}
+
+// recordCreated records the creation of a user in the audit log
+func (s *UserService) recordCreated(ctx context.Context, user *models.User, claims *auth.Claims) {
+	event := audit.Event{
+		Action:     audit.ActionUserCreated,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Changes:    audit.Diff(nil, user),
+	}
+	if claims == nil {
+		event.ActorID = &user.ID
+		event.ActorName = user.Username
+	}
+	audit.Record(ctx, s.recorder, claims, event)
+}
+
+// Update updates an existing user. Users changing their own email address must
+// give their current password, since reset links are sent to that address.
+func (s *UserService) Update(ctx context.Context, user *models.User, currentPassword string, claims *auth.Claims) error {
 	// Validate that the user exists
-	existingUser, err := s.userRepo.GetByID(user.ID)
+	existingUser, err := s.userRepo.GetByID(ctx, user.ID)
 	if err != nil {
 		return err
 	}
 
-	// Only admins can change roles
-	if existingUser.Role != user.Role && (claims == nil || claims.Role != "admin") {
-		return errors.New("only admins can change user roles")
-	}
-
-	// Only admins can update other admin users
-	if existingUser.Role == "admin" && claims.UserID != existingUser.ID && claims.Role != "admin" {
-		return errors.New("only admins can update admin users")
+	// Changing roles requires users:write and a role the caller could assign
+	if existingUser.Role != user.Role {
+		if claims == nil || !auth.HasPermission(claims, auth.PermUsersWrite) {
+			return errors.New("missing permission to change user roles")
+		}
+		if err := s.checkAssignableRole(ctx, user.Role, claims); err != nil {
+			return err
+		}
 	}
 
 	// Check if user is updating themselves
 	isSelf := claims.UserID == user.ID
 
-	// If not self and not admin, reject
-	if !isSelf && claims.Role != "admin" {
-		return errors.New("forbidden: can only update own user or must be admin")
+	if isSelf && !strings.EqualFold(existingUser.Email, user.Email) && !CheckPassword(existingUser.PasswordHash, currentPassword) {
+		return ErrIncorrectPassword
 	}
 
-	// If updating password, hash it
-	if user.PasswordHash != "" {
-		hashedPassword, err := HashPassword(user.PasswordHash)
-		if err != nil {
-			return err
+	// If not self, require users:write
+	if !isSelf && !auth.HasPermission(claims, auth.PermUsersWrite) {
+		return errors.New("forbidden: can only update own user or requires users:write permission")
+	}
+
+	// Users with more permissions than the caller can only update themselves
+	if !isSelf {
+		if err := s.checkAssignableRole(ctx, existingUser.Role, claims); err != nil {
+			return errors.New("forbidden: user has permissions you do not have")
 		}
-		user.PasswordHash = hashedPassword
 	}
 
 	// Update user
-	err = s.userRepo.Update(user)
+	err = s.userRepo.Update(ctx, user)
 	if err != nil {
 		return err
 	}
 
-	// Don't return password hash
-	user.PasswordHash = ""
+	// Only these fields are changed by an update
+	updatedUser := *existingUser
+	updatedUser.Username = user.Username
+	updatedUser.Email = user.Email
+	updatedUser.Role = user.Role
+
+	if changes := audit.Diff(existingUser, &updatedUser); len(changes) > 0 {
+		audit.Record(ctx, s.recorder, claims, audit.Event{
+			Action:     audit.ActionUserUpdated,
+			TargetType: audit.TargetUser,
+			TargetID:   strconv.Itoa(user.ID),
+			Changes:    changes,
+		})
+	}
+
+	return nil
+}
+
+// ChangePassword sets a new password for the current user after checking the
+// current one. The new password must satisfy the password policy.
+func (s *UserService) ChangePassword(ctx context.Context, claims *auth.Claims, currentPassword, newPassword string) error {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Check current password
+	if !CheckPassword(user.PasswordHash, currentPassword) {
+		return ErrIncorrectPassword
+	}
+
+	if err := s.passwordPolicy.checkNewPassword(ctx, s.userRepo, user, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionPasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+	})
+
 	return nil
 }
 
-// Delete removes a user
-func (s *UserService) Delete(id int, claims *auth.Claims) error {
+// PasswordSchemeReport counts users by the scheme and parameters of their
+// password hash, so it is visible how many accounts still await an upgrade
+func (s *UserService) PasswordSchemeReport(ctx context.Context, claims *auth.Claims) ([]models.PasswordSchemeCount, error) {
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersSecurity) {
+		return nil, errors.New("missing permission to view password schemes")
+	}
+
+	formats, err := s.userRepo.CountPasswordHashFormats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count password hashes: %w", err)
+	}
+
+	// Different headers can stand for the same scheme, e.g. $2a$ and $2b$
+	entries := make(map[string]*models.PasswordSchemeCount)
+	for format, users := range formats {
+		entry := models.PasswordSchemeCount{Scheme: "unknown"}
+		if scheme, params, ok := passwordHasher.Identify(format); ok {
+			entry.Scheme = scheme
+			entry.Params = params
+			entry.Current = !passwordHasher.NeedsRehash(format)
+		}
+
+		key := entry.Scheme + "$" + entry.Params
+		if entries[key] == nil {
+			entries[key] = &entry
+		}
+		entries[key].Users += users
+	}
+
+	report := make([]models.PasswordSchemeCount, 0, len(entries))
+	for _, entry := range entries {
+		report = append(report, *entry)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Users != report[j].Users {
+			return report[i].Users > report[j].Users
+		}
+		return report[i].Scheme+report[i].Params < report[j].Scheme+report[j].Params
+	})
+
+	return report, nil
+}
+
+// Deactivate disables a user instead of deleting them, so their orders and
+// inventory transactions keep referring to them. All sessions of the user are
+// revoked.
+func (s *UserService) Deactivate(ctx context.Context, id int, claims *auth.Claims) error {
 	// Get existing user
-	existingUser, err := s.userRepo.GetByID(id)
+	existingUser, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	// Check permissions
-	if claims.Role != "admin" {
-		return errors.New("only admins can delete users")
+	if !auth.HasPermission(claims, auth.PermUsersDelete) {
+		return errors.New("missing permission to deactivate users")
+	}
+
+	// Prevent users from deactivating themselves
+	if claims.UserID == id {
+		return errors.New("users cannot deactivate themselves")
+	}
+
+	// Users with more permissions than the caller cannot be deactivated by them
+	if err := s.checkAssignableRole(ctx, existingUser.Role, claims); err != nil {
+		return errors.New("forbidden: user has permissions you do not have")
+	}
+
+	if err := s.userRepo.SetActive(ctx, id, false); err != nil {
+		return err
 	}
 
-	// Prevent admin from deleting themselves
-	if claims.UserID == id && claims.Role == "admin" {
-		return errors.New("admins cannot delete themselves")
+	// Sign the user out everywhere
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, id); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
 	}
 
-	// If trying to delete an admin, require confirmation
-	if existingUser.Role == "admin" {
-		// In a real application, you might require additional confirmation
-		// For now, just allow it
+	if err := s.denylist.RevokeUser(ctx, id); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
 	}
 
-	return s.userRepo.Delete(id)
+	s.recordStateChange(ctx, claims, audit.ActionUserDeactivated, existingUser, false)
+
+	return nil
 }
 
-// isValidRole checks if a role is valid
-func isValidRole(role string) bool {
-	validRoles := []string{"admin", "bartender", "guest"}
-	for _, validRole := range validRoles {
-		if role == validRole {
-			return true
-		}
+// Reactivate lets a deactivated user log in again
+func (s *UserService) Reactivate(ctx context.Context, id int, claims *auth.Claims) error {
+	// Get existing user
+	existingUser, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersDelete) {
+		return errors.New("missing permission to reactivate users")
 	}
-	return false
-} 
\ No newline at end of file
+
+	// Users with more permissions than the caller cannot be reactivated by them
+	if err := s.checkAssignableRole(ctx, existingUser.Role, claims); err != nil {
+		return errors.New("forbidden: user has permissions you do not have")
+	}
+
+	if err := s.userRepo.SetActive(ctx, id, true); err != nil {
+		return err
+	}
+
+	s.recordStateChange(ctx, claims, audit.ActionUserReactivated, existingUser, true)
+
+	return nil
+}
+
+// Erase permanently deletes a deactivated user, e.g. to honor a deletion
+// request. Orders and inventory transactions of the user lose the reference.
+func (s *UserService) Erase(ctx context.Context, id int, claims *auth.Claims) error {
+	// Get existing user
+	existingUser, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Check permissions
+	if !auth.HasPermission(claims, auth.PermUsersErase) {
+		return errors.New("missing permission to erase users")
+	}
+
+	// Users with more permissions than the caller cannot be erased by them
+	if err := s.checkAssignableRole(ctx, existingUser.Role, claims); err != nil {
+		return errors.New("forbidden: user has permissions you do not have")
+	}
+
+	// Only deactivated users can be erased, which also rules out the caller
+	if existingUser.Active {
+		return errors.New("user must be deactivated before being erased")
+	}
+
+	if err := s.userRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	// Keep what was erased in the log, since the row itself is gone
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     audit.ActionUserErased,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(id),
+		Changes:    audit.Diff(existingUser, nil),
+	})
+
+	return nil
+}
+
+// recordStateChange audits the deactivation or reactivation of a user
+func (s *UserService) recordStateChange(ctx context.Context, claims *auth.Claims, action string, user *models.User, active bool) {
+	audit.Record(ctx, s.recorder, claims, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.Itoa(user.ID),
+		Changes: map[string]audit.Change{
+			"active": {From: user.Active, To: active},
+		},
+	})
+}
+
+// checkAssignableRole checks that a role exists and grants no permission the
+// caller does not have, so nobody can hand out more access than they hold
+func (s *UserService) checkAssignableRole(ctx context.Context, roleName string, claims *auth.Claims) error {
+	role, err := s.roleRepo.GetByName(ctx, roleName)
+	if err != nil {
+		return errors.New("invalid role")
+	}
+
+	if claims == nil || !canGrant(claims, role.Permissions) {
+		return fmt.Errorf("missing permissions to assign role %s", role.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// Actions recorded by the services
+const (
+	ActionLogin                = "auth.login"
+	ActionLoginFailed          = "auth.login_failed"
+	ActionLogout               = "auth.logout"
+	ActionSessionsRevoked      = "auth.sessions_revoked"
+	ActionSessionRevoked       = "auth.session_revoked"
+	ActionUserUnlocked         = "auth.user_unlocked"
+	ActionUserCreated          = "user.created"
+	ActionUserUpdated          = "user.updated"
+	ActionPasswordChanged      = "user.password_changed"
+	ActionUserDeactivated      = "user.deactivated"
+	ActionUserReactivated      = "user.reactivated"
+	ActionUserErased           = "user.erased"
+	ActionIdentityLinked       = "user.identity_linked"
+	ActionIdentityUnlinked     = "user.identity_unlinked"
+	ActionImpersonationStarted = "auth.impersonation_started"
+	ActionImpersonatedRequest  = "auth.impersonated_request"
+)
+
+// TargetUser is the target type of events about user accounts
+const TargetUser = "user"
+
+// Change is the value of a field before and after an action
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Event is an entry in the audit log
+type Event struct {
+	ID         int64             `json:"id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	ActorID    *int              `json:"actor_id,omitempty"`
+	ActorName  string            `json:"actor_name,omitempty"`
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	Changes    map[string]Change `json:"changes,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+}
+
+// Recorder stores audit events
+type Recorder interface {
+	Record(ctx context.Context, event Event) error
+}
+
+// RequestInfo describes the HTTP request an action was made in
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// requestInfoKey is the context key of the RequestInfo
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a context carrying the client of a request
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the client of the request, if known
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// Middleware stores the client IP and user agent in the request context so
+// that services can record them without access to the request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithRequestInfo(r.Context(), RequestInfo{
+			IP:        middleware.ClientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ImpersonationMiddleware records every request made with an impersonation
+// token, with its route and response status, against the impersonated user.
+// It must run after Authenticate.
+func ImpersonationMiddleware(recorder Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok || !principal.Impersonated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			claims := principal.Claims
+
+			lrw := middleware.NewLoggingResponseWriter(w)
+			next.ServeHTTP(lrw, r)
+
+			Record(r.Context(), recorder, claims, Event{
+				Action:     ActionImpersonatedRequest,
+				TargetType: TargetUser,
+				TargetID:   strconv.Itoa(claims.UserID),
+				Changes: map[string]Change{
+					"request": {From: nil, To: r.Method + " " + r.URL.Path},
+					"status":  {From: nil, To: lrw.StatusCode()},
+				},
+			})
+		})
+	}
+}
+
+// Record stores an event with the client of the request in ctx. The actor is
+// taken from claims; without claims, e.g. for logins, the actor set in the
+// event is kept. For impersonation tokens the actor is the admin, named as
+// "admin as user". Failures are only logged, since the action has already
+// happened by the time it is recorded.
+func Record(ctx context.Context, recorder Recorder, claims *auth.Claims, event Event) {
+	if claims != nil {
+		if claims.Actor != nil {
+			actorID := claims.Actor.UserID
+			event.ActorID = &actorID
+			event.ActorName = claims.Actor.Username + " as " + claims.Username
+		} else if claims.ClientID != 0 {
+			event.ActorName = "client:" + strconv.Itoa(claims.ClientID)
+		} else {
+			actorID := claims.UserID
+			event.ActorID = &actorID
+			event.ActorName = claims.Username
+		}
+	}
+
+	info := RequestInfoFromContext(ctx)
+	event.IP = info.IP
+	event.UserAgent = info.UserAgent
+
+	if err := recorder.Record(ctx, event); err != nil {
+		logging.FromContext(ctx).Error("Error recording audit event", "action", event.Action, "error", err)
+	}
+}
+
+// Diff returns the fields of before and after that differ. Both must be of
+// the same struct type; fields are compared by their JSON representation and
+// fields hidden from JSON, such as password hashes, are ignored.
+func Diff(before, after interface{}) map[string]Change {
+	from := toFields(before)
+	to := toFields(after)
+
+	changes := make(map[string]Change)
+	for name, value := range to {
+		if !reflect.DeepEqual(from[name], value) {
+			changes[name] = Change{From: from[name], To: value}
+		}
+	}
+	for name, value := range from {
+		if _, ok := to[name]; !ok {
+			changes[name] = Change{From: value, To: nil}
+		}
+	}
+
+	return changes
+}
+
+// toFields converts a value to a map of its JSON fields
+func toFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+
+	return fields
+}
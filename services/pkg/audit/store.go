@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/csvutil"
+)
+
+// Filter selects audit events. Zero values match everything.
+type Filter struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// Page is one page of audit events
+type Page struct {
+	Events []Event `json:"events"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// CSVHeader is the header row of audit event CSV exports
+var CSVHeader = []string{"id", "occurred_at", "actor_id", "actor_name", "action", "target_type", "target_id", "changes", "ip", "user_agent"}
+
+// CSVRecord returns the event as a CSV row matching CSVHeader. Text cells
+// are escaped, since names and user agents come from the clients.
+func (e Event) CSVRecord() []string {
+	actorID := ""
+	if e.ActorID != nil {
+		actorID = strconv.Itoa(*e.ActorID)
+	}
+
+	changes := ""
+	if len(e.Changes) > 0 {
+		data, _ := json.Marshal(e.Changes)
+		changes = string(data)
+	}
+
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		e.OccurredAt.UTC().Format(time.RFC3339),
+		actorID,
+		csvutil.Escape(e.ActorName),
+		csvutil.Escape(e.Action),
+		csvutil.Escape(e.TargetType),
+		csvutil.Escape(e.TargetID),
+		csvutil.Escape(changes),
+		csvutil.Escape(e.IP),
+		csvutil.Escape(e.UserAgent),
+	}
+}
+
+// SQLRecorder stores audit events in the append-only audit_events table
+type SQLRecorder struct {
+	db *sql.DB
+}
+
+// NewSQLRecorder creates a new SQLRecorder
+func NewSQLRecorder(db *sql.DB) *SQLRecorder {
+	return &SQLRecorder{
+		db: db,
+	}
+}
+
+// Record implements Recorder
+func (r *SQLRecorder) Record(ctx context.Context, event Event) error {
+	var changes []byte
+	if len(event.Changes) > 0 {
+		var err error
+		if changes, err = json.Marshal(event.Changes); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO audit_events (actor_id, actor_name, action, target_type, target_id, changes, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		event.ActorID,
+		nullString(event.ActorName),
+		event.Action,
+		nullString(event.TargetType),
+		nullString(event.TargetID),
+		changes,
+		nullString(event.IP),
+		nullString(event.UserAgent),
+	)
+	return err
+}
+
+// List retrieves the events matching a filter, newest first
+func (r *SQLRecorder) List(ctx context.Context, filter Filter) ([]Event, error) {
+	events := []Event{}
+	err := r.Each(ctx, filter, func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Each calls fn for every event matching a filter, newest first, without
+// loading all of them into memory
+func (r *SQLRecorder) Each(ctx context.Context, filter Filter, fn func(Event) error) error {
+	where, args := filter.conditions()
+
+	query := `
+		SELECT event_id, occurred_at, actor_id, COALESCE(actor_name, ''), action,
+			COALESCE(target_type, ''), COALESCE(target_id, ''), changes,
+			COALESCE(ip, ''), COALESCE(user_agent, '')
+		FROM audit_events
+	` + where + ` ORDER BY occurred_at DESC, event_id DESC`
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+		var changes []byte
+		if err := rows.Scan(
+			&event.ID,
+			&event.OccurredAt,
+			&event.ActorID,
+			&event.ActorName,
+			&event.Action,
+			&event.TargetType,
+			&event.TargetID,
+			&changes,
+			&event.IP,
+			&event.UserAgent,
+		); err != nil {
+			return err
+		}
+
+		if len(changes) > 0 {
+			if err := json.Unmarshal(changes, &event.Changes); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Count returns the number of events matching a filter, ignoring its pagination
+func (r *SQLRecorder) Count(ctx context.Context, filter Filter) (int, error) {
+	where, args := filter.conditions()
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events `+where, args...).Scan(&total)
+	return total, err
+}
+
+// conditions builds the WHERE clause of a filter
+func (f Filter) conditions() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ActorID != nil {
+		add("actor_id = $%d", *f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if f.From != nil {
+		add("occurred_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("occurred_at < $%d", *f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
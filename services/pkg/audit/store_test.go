@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventCSVRecordEscapesFormulas(t *testing.T) {
+	actorID := 3
+	event := Event{
+		ID:         42,
+		OccurredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		ActorID:    &actorID,
+		ActorName:  "=HYPERLINK(\"http://evil\",\"x\")",
+		Action:     ActionLoginFailed,
+		TargetType: TargetUser,
+		TargetID:   "-1",
+		IP:         "10.0.0.1",
+		UserAgent:  "@SUM(1+1)",
+	}
+
+	record := event.CSVRecord()
+	if len(record) != len(CSVHeader) {
+		t.Fatalf("record has %d cells, header %d", len(record), len(CSVHeader))
+	}
+
+	want := map[string]string{
+		"id":          "42",
+		"occurred_at": "2024-05-01T12:00:00Z",
+		"actor_id":    "3",
+		"actor_name":  "'=HYPERLINK(\"http://evil\",\"x\")",
+		"target_id":   "'-1",
+		"ip":          "10.0.0.1",
+		"user_agent":  "'@SUM(1+1)",
+	}
+	for i, column := range CSVHeader {
+		if value, ok := want[column]; ok && record[i] != value {
+			t.Errorf("%s = %q, want %q", column, record[i], value)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/lib/pq"
+)
+
+// APIKeyHeader is the header machine clients send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyKind is the leading part of every API key
+const APIKeyKind = "bak"
+
+// RoleAPIClient is the role of claims that belong to a machine client. It is
+// not a user role, so role checks for users never match machine clients.
+const RoleAPIClient = "api_client"
+
+// ErrInvalidAPIKey is returned for unknown, malformed, expired or revoked API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyValidator resolves an API key to the claims of its machine client
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, key string) (*Claims, error)
+}
+
+// apiKeyValidator is consulted by ValidateAPIKey when set
+var apiKeyValidator APIKeyValidator
+
+// SetAPIKeyValidator configures how API keys are checked. Services that share
+// the auth database should call this at startup with a SQLAPIKeyValidator.
+func SetAPIKeyValidator(v APIKeyValidator) {
+	apiKeyValidator = v
+}
+
+// ValidateAPIKey validates an API key and returns the claims of its client
+func ValidateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	if apiKeyValidator == nil {
+		return nil, errors.New("API keys are not accepted by this service")
+	}
+	return apiKeyValidator.ValidateAPIKey(ctx, key)
+}
+
+// NewSecretKey creates a random secret key of the form <kind>_<prefix>_<secret>.
+// The prefix can be stored in clear text to look the key up; only the hash of
+// the whole key should be stored.
+func NewSecretKey(kind string) (key, prefix, hash string, err error) {
+	p := make([]byte, 4)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(p)
+	key = kind + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	return key, prefix, HashSecretKey(key), nil
+}
+
+// ParseSecretKey returns the prefix of a secret key of the given kind
+func ParseSecretKey(kind, key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != kind || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// HashSecretKey returns the hex-encoded SHA-256 hash of a secret key
+func HashSecretKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SecretKeyMatches compares a secret key against a stored hash in constant time
+func SecretKeyMatches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecretKey(key)), []byte(hash)) == 1
+}
+
+// SQLAPIKeyValidator is an APIKeyValidator backed by the api_clients table
+type SQLAPIKeyValidator struct {
+	db *sql.DB
+}
+
+// NewSQLAPIKeyValidator creates a new SQLAPIKeyValidator
+func NewSQLAPIKeyValidator(db *sql.DB) *SQLAPIKeyValidator {
+	return &SQLAPIKeyValidator{
+		db: db,
+	}
+}
+
+// ValidateAPIKey looks the key up by its prefix, checks its hash, expiry and
+// revocation and records when it was last used
+func (v *SQLAPIKeyValidator) ValidateAPIKey(ctx context.Context, key string) (*Claims, error) {
+	prefix, ok := ParseSecretKey(APIKeyKind, key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	query := `
+		SELECT client_id, name, scopes, key_hash, expires_at, revoked_at
+		FROM api_clients
+		WHERE key_prefix = $1
+	`
+
+	var (
+		clientID  int
+		name      string
+		scopes    []string
+		keyHash   string
+		expiresAt *time.Time
+		revokedAt *time.Time
+	)
+	err := v.db.QueryRowContext(ctx, query, prefix).Scan(&clientID, &name, pq.Array(&scopes), &keyHash, &expiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	if !SecretKeyMatches(key, keyHash) || revokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if expiresAt != nil && time.Now().After(*expiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Record usage at most once a minute to keep busy clients from writing on every request
+	_, err = v.db.ExecContext(ctx, `
+		UPDATE api_clients
+		SET last_used_at = NOW()
+		WHERE client_id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, clientID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error updating API key last use", "client_id", clientID, "error", err)
+	}
+
+	claims := &Claims{
+		Username: name,
+		Role:     RoleAPIClient,
+		ClientID: clientID,
+		Scopes:   scopes,
+		// Scopes are permissions, so RequirePermission treats clients and users alike
+		Permissions: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  "bartenderapp",
+			Subject: fmt.Sprintf("client:%d", clientID),
+		},
+	}
+	if expiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*expiresAt)
+	}
+
+	return claims, nil
+}
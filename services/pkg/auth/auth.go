@@ -1,15 +1,20 @@
 package auth
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/ignaseim/bartenderapp/services/pkg/models"
 )
 
 // JWT claims structure
@@ -18,62 +23,206 @@ type Claims struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+	// SessionID identifies the login (refresh token family) the token belongs to
+	SessionID string `json:"sid,omitempty"`
+	// TokenUse is empty for access tokens and set for special purpose tokens
+	TokenUse string `json:"token_use,omitempty"`
+	// AuthMethods lists the authentication methods used (RFC 8176 amr values)
+	AuthMethods []string `json:"amr,omitempty"`
+	// TerminalID is set on tokens issued by a PIN login on a registered terminal
+	TerminalID int `json:"terminal_id,omitempty"`
+	// ClientID is set instead of UserID when a machine client authenticated with an API key
+	ClientID int `json:"client_id,omitempty"`
+	// Scopes limit what a machine client may do
+	Scopes []string `json:"scopes,omitempty"`
+	// Permissions granted to the user by their role, or the scopes of a machine client
+	Permissions []string `json:"permissions,omitempty"`
+	// Actor is set on impersonation tokens and identifies the admin acting as the user
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(user models.User) (string, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
+// Actor identifies who acts on behalf of the user of a token (RFC 8693 act claim)
+type Actor struct {
+	Subject  string `json:"sub"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Impersonated reports whether the token was issued to someone acting as its user
+func (c *Claims) Impersonated() bool {
+	return c.Actor != nil
+}
+
+// OnTerminal reports whether the token was issued by a PIN login on a terminal
+func (c *Claims) OnTerminal() bool {
+	return c.TokenUse == TokenUseTerminal
+}
+
+// Token uses for tokens that must not be accepted as access tokens
+const (
+	TokenUseMFAChallenge   = "mfa_challenge"
+	TokenUsePasswordChange = "password_change"
+)
+
+// TokenUseTerminal marks the access tokens of PIN logins on a terminal. They
+// are accepted as access tokens, but not for changes to accounts and
+// credentials, see middleware.DenyTerminal.
+const TokenUseTerminal = "terminal"
+
+// ErrWrongAudience is returned by ValidateToken for service tokens issued for
+// another service
+var ErrWrongAudience = errors.New("token is not valid for this service")
+
+// KeySource resolves the public key that verifies tokens signed with a key ID
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+var (
+	keySource   KeySource
+	keySourceMu sync.Mutex
+)
+
+// SetKeySource configures the keys used by ValidateToken. The auth service uses
+// its own Signer; other services fall back to the auth service JWKS endpoint.
+func SetKeySource(ks KeySource) {
+	keySourceMu.Lock()
+	defer keySourceMu.Unlock()
+	keySource = ks
+}
+
+// currentKeySource returns the configured KeySource, creating a JWKSVerifier
+// from JWKS_URL or AUTH_SERVICE_URL on first use if none was set
+func currentKeySource() (KeySource, error) {
+	keySourceMu.Lock()
+	defer keySourceMu.Unlock()
+
+	if keySource != nil {
+		return keySource, nil
 	}
 
-	// Create claims with user information
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "bartenderapp",
-			Subject:   fmt.Sprintf("%d", user.ID),
-		},
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		if authURL := os.Getenv("AUTH_SERVICE_URL"); authURL != "" {
+			jwksURL = strings.TrimRight(authURL, "/") + "/.well-known/jwks.json"
+		}
+	}
+	if jwksURL == "" {
+		return nil, errors.New("token verification keys are not configured: set JWKS_URL or AUTH_SERVICE_URL")
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	keySource = NewJWKSVerifier(jwksURL, defaultJWKSCacheTTL)
+	return keySource, nil
+}
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(secretKey))
+var (
+	audience    string
+	audienceSet bool
+	audienceMu  sync.Mutex
+)
+
+// SetAudience sets the name of this service in the aud claim of service
+// tokens. Without it TOKEN_AUDIENCE is used.
+func SetAudience(aud string) {
+	audienceMu.Lock()
+	defer audienceMu.Unlock()
+	audience = aud
+	audienceSet = true
+}
+
+// AcceptsAudience reports whether a token issued for the given audiences may
+// be used with this service. Tokens without an audience, such as the access
+// tokens of users, are accepted by every service.
+func AcceptsAudience(aud []string) bool {
+	if len(aud) == 0 {
+		return true
+	}
+
+	audienceMu.Lock()
+	if !audienceSet {
+		audience = os.Getenv("TOKEN_AUDIENCE")
+		audienceSet = true
+	}
+	own := audience
+	audienceMu.Unlock()
+
+	if own == "" {
+		return false
+	}
+	for _, a := range aud {
+		if a == own {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateToken validates a JWT access token and returns the claims
+func ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	return ValidateTokenUse(ctx, tokenString, "")
+}
+
+// ValidateTokenUse validates a JWT token issued for a specific use, such as
+// an MFA challenge, and returns the claims. Tokens issued for another use are
+// rejected, so a challenge token can never act as an access token, and so are
+// service tokens issued for another service.
+func ValidateTokenUse(ctx context.Context, tokenString, use string) (*Claims, error) {
+	claims, err := parseToken(ctx, tokenString, use)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if !AcceptsAudience(claims.Audience) {
+		return nil, ErrWrongAudience
 	}
 
-	return tokenString, nil
+	return claims, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func ValidateToken(tokenString string) (*Claims, error) {
-	// Get secret key from environment
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		return nil, errors.New("JWT_SECRET environment variable is not set")
+// ParseToken validates a JWT access token like ValidateToken but accepts
+// tokens issued for any service. It is meant for token introspection, where
+// the service asking checks the audience itself.
+func ParseToken(ctx context.Context, tokenString string) (*Claims, error) {
+	return parseToken(ctx, tokenString, "")
+}
+
+// parseToken checks the signature, lifetime, use and revocation of a token
+func parseToken(ctx context.Context, tokenString, use string) (*Claims, error) {
+	ks, err := currentKeySource()
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse the token
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+
+		key, err := ks.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// Make sure the algorithm matches the type of the key
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+		case ed25519.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+		default:
+			return nil, fmt.Errorf("unsupported key type for key %q", kid)
 		}
-		return []byte(secretKey), nil
-	})
+
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -83,6 +232,21 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.TokenUse != use && !(use == "" && claims.OnTerminal()) {
+		return nil, errors.New("token is not valid for this use")
+	}
+
+	// Check the denylist for logged out or revoked tokens
+	if denylist != nil {
+		revoked, err := denylist.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
 	return claims, nil
 }
 
@@ -110,4 +274,25 @@ func HasRole(claims *Claims, roles ...string) bool {
 		}
 	}
 	return false
-} 
\ No newline at end of file
+}
+
+// HasPermission checks if the claims grant one of the permissions
+func HasPermission(claims *Claims, permissions ...string) bool {
+	for _, permission := range permissions {
+		for _, granted := range claims.Permissions {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newTokenID generates a random identifier for the jti claim
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+func TestValidateTokenUses(t *testing.T) {
+	signer, err := NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeySource(signer)
+	defer SetKeySource(nil)
+
+	user := models.User{ID: 7, Username: "ana", Role: "bartender"}
+
+	tests := []struct {
+		name    string
+		issued  string
+		use     string
+		wantErr bool
+	}{
+		{"access token", "", "", false},
+		{"terminal token as access token", TokenUseTerminal, "", false},
+		{"terminal token as MFA challenge", TokenUseTerminal, TokenUseMFAChallenge, true},
+		{"terminal token as password change", TokenUseTerminal, TokenUsePasswordChange, true},
+		{"MFA challenge as access token", TokenUseMFAChallenge, "", true},
+		{"password change as access token", TokenUsePasswordChange, "", true},
+		{"access token as MFA challenge", "", TokenUseMFAChallenge, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := signer.GenerateToken(user, TokenOptions{Use: tt.issued})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ValidateTokenUse(context.Background(), token, tt.use)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTokenUse() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && claims.OnTerminal() != (tt.issued == TokenUseTerminal) {
+				t.Errorf("OnTerminal() = %v for a %q token", claims.OnTerminal(), tt.issued)
+			}
+		})
+	}
+}
+
+func TestIntrospectionClaimsKeepTerminal(t *testing.T) {
+	claims := &Claims{UserID: 7, TokenUse: TokenUseTerminal, TerminalID: 2}
+
+	if got := NewIntrospection(claims, TokenTypeAccess).Claims(); !got.OnTerminal() || got.TerminalID != 2 {
+		t.Errorf("Claims() = %+v, want a terminal token of terminal 2", got)
+	}
+}
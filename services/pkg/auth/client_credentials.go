@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+// clientTokenRefreshMargin is how long before expiry a cached token is renewed
+const clientTokenRefreshMargin = 30 * time.Second
+
+// ClientCredentials obtains access tokens for calls to another service with
+// the OAuth 2.0 client credentials grant and reuses them until shortly before
+// they expire. The client ID and secret are those of an API client; the API
+// key itself never leaves the hop to the auth service.
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	audience     string
+	scopes       []string
+	client       *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewClientCredentials creates a new ClientCredentials for the auth service at
+// authURL. Tokens are issued for audience with the given scopes, or all scopes
+// of the client if none are given.
+func NewClientCredentials(authURL, clientID, clientSecret, audience string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		tokenURL:     strings.TrimRight(authURL, "/") + "/oauth/token",
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		audience:     audience,
+		scopes:       scopes,
+		client:       tracing.NewClient(5 * time.Second),
+	}
+}
+
+// NewClientCredentialsFromEnv creates a ClientCredentials from
+// AUTH_SERVICE_URL, SERVICE_CLIENT_ID and SERVICE_API_KEY
+func NewClientCredentialsFromEnv(audience string, scopes ...string) (*ClientCredentials, error) {
+	authURL := os.Getenv("AUTH_SERVICE_URL")
+	clientID := os.Getenv("SERVICE_CLIENT_ID")
+	apiKey := os.Getenv("SERVICE_API_KEY")
+	if authURL == "" || clientID == "" || apiKey == "" {
+		return nil, errors.New("service credentials are not configured: set AUTH_SERVICE_URL, SERVICE_CLIENT_ID and SERVICE_API_KEY")
+	}
+
+	return NewClientCredentials(authURL, clientID, apiKey, audience, scopes...), nil
+}
+
+// Token returns a valid access token, requesting a new one if needed
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(clientTokenRefreshMargin).Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"audience":   {c.audience},
+	}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	logging.SetRequestID(req)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request service token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("failed to request service token: %s %s", body.Error, body.ErrorDescription)
+	}
+
+	c.token = body.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// Authorize adds a bearer token to an outgoing request
+func (c *ClientCredentials) Authorize(r *http.Request) error {
+	token, err := c.Token(r.Context())
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
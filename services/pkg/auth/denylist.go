@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTokenRevoked is returned by ValidateToken for tokens on the denylist
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Denylist reports whether an otherwise valid token has been revoked
+type Denylist interface {
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// denylist is consulted by ValidateToken when set
+var denylist Denylist
+
+// SetDenylist configures the denylist checked by ValidateToken. Services that
+// share the auth database should call this at startup with a SQLDenylist.
+func SetDenylist(d Denylist) {
+	denylist = d
+}
+
+// SQLDenylist is a Denylist backed by the revoked_tokens and
+// user_token_revocations tables
+type SQLDenylist struct {
+	db *sql.DB
+}
+
+// NewSQLDenylist creates a new SQLDenylist
+func NewSQLDenylist(db *sql.DB) *SQLDenylist {
+	return &SQLDenylist{
+		db: db,
+	}
+}
+
+// IsRevoked checks whether the token itself, its session, the terminal it was
+// issued on or all tokens of its user issued before a cutoff have been revoked
+func (d *SQLDenylist) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM sessions WHERE session_id = NULLIF($3, '')::uuid AND revoked_at IS NOT NULL)
+			OR EXISTS (SELECT 1 FROM terminals WHERE terminal_id = $4 AND revoked_at IS NOT NULL),
+			(SELECT revoked_before FROM user_token_revocations WHERE user_id = $2)
+	`
+
+	var revoked bool
+	var revokedBefore sql.NullTime
+	err := d.db.QueryRowContext(ctx, query, claims.ID, claims.UserID, claims.SessionID, claims.TerminalID).Scan(&revoked, &revokedBefore)
+	if err != nil {
+		return false, err
+	}
+
+	if revokedBefore.Valid && issuedBefore(issuedAt, revokedBefore.Time) {
+		return true, nil
+	}
+
+	return revoked, nil
+}
+
+// revocationCutoff returns the cutoff stored when all tokens of a user are
+// revoked at now. Token iat claims only have whole seconds, so the cutoff is
+// truncated as well; otherwise the fresh tokens issued right after a password
+// change, in the same second, would be revoked too.
+func revocationCutoff(now time.Time) time.Time {
+	return now.Truncate(time.Second)
+}
+
+// issuedBefore reports whether a token issued at issuedAt falls under a
+// revocation with the given cutoff. Cutoffs stored before they were truncated
+// are truncated here.
+func issuedBefore(issuedAt, cutoff time.Time) bool {
+	return issuedAt.Before(revocationCutoff(cutoff))
+}
+
+// RevokeToken adds a single token to the denylist until it expires
+func (d *SQLDenylist) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti claim")
+	}
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	_, err := d.db.ExecContext(ctx, query, claims.ID, claims.UserID, expiresAt)
+	return err
+}
+
+// RevokeUser revokes every token issued to a user up to now
+func (d *SQLDenylist) RevokeUser(ctx context.Context, userID int) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before
+	`
+
+	_, err := d.db.ExecContext(ctx, query, userID, revocationCutoff(time.Now()))
+	return err
+}
+
+// PurgeExpired removes denylist entries for tokens that have expired
+func (d *SQLDenylist) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
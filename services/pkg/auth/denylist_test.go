@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+func TestIssuedBefore(t *testing.T) {
+	cutoff := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		cutoff   time.Time
+		want     bool
+	}{
+		{"earlier second", cutoff.Add(-time.Second), cutoff, true},
+		{"long before", cutoff.Add(-time.Hour), cutoff, true},
+		{"same second", cutoff, cutoff, false},
+		{"later", cutoff.Add(time.Second), cutoff, false},
+		{"same second as an untruncated cutoff", cutoff, cutoff.Add(600 * time.Millisecond), false},
+		{"before an untruncated cutoff", cutoff.Add(-time.Second), cutoff.Add(600 * time.Millisecond), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := issuedBefore(tt.issuedAt, tt.cutoff); got != tt.want {
+				t.Errorf("issuedBefore(%v, %v) = %v, want %v", tt.issuedAt, tt.cutoff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenIssuedRightAfterRevokeUser(t *testing.T) {
+	signer, err := NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RevokeUser stores this cutoff; a password change then issues new tokens
+	cutoff := revocationCutoff(time.Now())
+
+	token, err := signer.GenerateToken(models.User{ID: 7, Username: "ana", Role: "bartender"}, TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if issuedBefore(claims.IssuedAt.Time, cutoff) {
+		t.Errorf("token issued at %v is revoked by the cutoff %v", claims.IssuedAt.Time, cutoff)
+	}
+}
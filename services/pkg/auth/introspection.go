@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+const (
+	// defaultIntrospectionCacheTTL is how long introspection results are reused
+	defaultIntrospectionCacheTTL = 30 * time.Second
+
+	// maxIntrospectionCacheEntries bounds the memory used by the cache
+	maxIntrospectionCacheEntries = 10000
+)
+
+// Token types reported by introspection
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+	TokenTypeAPIKey  = "api_key"
+)
+
+// ErrInactiveToken is returned by IntrospectionClient.Validate for tokens the
+// auth service does not consider active
+var ErrInactiveToken = errors.New("token is not active")
+
+// ErrWrongTokenType is returned by IntrospectionClient.Validate for active
+// tokens that are not credentials, such as refresh tokens
+var ErrWrongTokenType = errors.New("token cannot be used as a credential")
+
+// Introspection is the response of the token introspection endpoint as
+// defined in RFC 7662. Inactive tokens only carry Active; the fields after
+// Issuer are extensions with the claims services need for permission checks.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+
+	UserID      int      `json:"user_id,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	TerminalID  int      `json:"terminal_id,omitempty"`
+	Actor       *Actor   `json:"act,omitempty"`
+}
+
+// NewIntrospection describes the active token with the given claims
+func NewIntrospection(claims *Claims, tokenType string) *Introspection {
+	i := &Introspection{
+		Active:      true,
+		Scope:       strings.Join(claims.Scopes, " "),
+		Username:    claims.Username,
+		TokenType:   tokenType,
+		Subject:     claims.Subject,
+		Audience:    claims.Audience,
+		Issuer:      claims.Issuer,
+		TokenID:     claims.ID,
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		SessionID:   claims.SessionID,
+		TerminalID:  claims.TerminalID,
+		Actor:       claims.Actor,
+	}
+	if claims.ClientID != 0 {
+		i.ClientID = fmt.Sprintf("%d", claims.ClientID)
+	}
+	if claims.ExpiresAt != nil {
+		i.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		i.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		i.NotBefore = claims.NotBefore.Unix()
+	}
+	return i
+}
+
+// Claims converts an active introspection result back to claims, so that
+// handlers and permission checks work the same as with local validation
+func (i *Introspection) Claims() *Claims {
+	claims := &Claims{
+		UserID:      i.UserID,
+		Username:    i.Username,
+		Email:       i.Email,
+		Role:        i.Role,
+		SessionID:   i.SessionID,
+		TerminalID:  i.TerminalID,
+		Permissions: i.Permissions,
+		Actor:       i.Actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       i.TokenID,
+			Issuer:   i.Issuer,
+			Subject:  i.Subject,
+			Audience: i.Audience,
+		},
+	}
+	if i.TerminalID != 0 {
+		claims.TokenUse = TokenUseTerminal
+	}
+	if i.ClientID != "" {
+		claims.ClientID, _ = strconv.Atoi(i.ClientID)
+	}
+	if i.Scope != "" {
+		claims.Scopes = strings.Fields(i.Scope)
+	}
+	if i.ExpiresAt != 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(i.ExpiresAt, 0))
+	}
+	if i.IssuedAt != 0 {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(i.IssuedAt, 0))
+	}
+	if i.NotBefore != 0 {
+		claims.NotBefore = jwt.NewNumericDate(time.Unix(i.NotBefore, 0))
+	}
+	return claims
+}
+
+// IntrospectionClient asks the auth service whether tokens are active. It
+// suits services that must notice revoked tokens and API keys without access
+// to the auth database. Results are cached briefly, and never beyond the
+// expiry of the token, so busy services do not call the auth service for
+// every request.
+type IntrospectionClient struct {
+	url    string
+	apiKey string
+	ttl    time.Duration
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspectionEntry
+}
+
+// introspectionEntry is a cached introspection result
+type introspectionEntry struct {
+	result  *Introspection
+	expires time.Time
+}
+
+// NewIntrospectionClient creates a new IntrospectionClient for the auth
+// service at authURL. The client authenticates with an API key whose client
+// has the tokens:introspect scope.
+func NewIntrospectionClient(authURL, apiKey string, ttl time.Duration) *IntrospectionClient {
+	if ttl <= 0 {
+		ttl = defaultIntrospectionCacheTTL
+	}
+
+	return &IntrospectionClient{
+		url:    strings.TrimRight(authURL, "/") + "/introspect",
+		apiKey: apiKey,
+		ttl:    ttl,
+		client: tracing.NewClient(5 * time.Second),
+		cache:  make(map[string]introspectionEntry),
+	}
+}
+
+// NewIntrospectionClientFromEnv creates an IntrospectionClient from
+// AUTH_SERVICE_URL and SERVICE_API_KEY
+func NewIntrospectionClientFromEnv() (*IntrospectionClient, error) {
+	authURL := os.Getenv("AUTH_SERVICE_URL")
+	apiKey := os.Getenv("SERVICE_API_KEY")
+	if authURL == "" || apiKey == "" {
+		return nil, errors.New("token introspection is not configured: set AUTH_SERVICE_URL and SERVICE_API_KEY")
+	}
+
+	return NewIntrospectionClient(authURL, apiKey, defaultIntrospectionCacheTTL), nil
+}
+
+// Introspect returns the introspection result for a token, from the cache if
+// possible. Inactive tokens are cached too; errors are not.
+func (c *IntrospectionClient) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	key := HashSecretKey(token)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.result, nil
+	}
+
+	result, err := c.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(c.ttl)
+	if result.Active && result.ExpiresAt != 0 {
+		if exp := time.Unix(result.ExpiresAt, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxIntrospectionCacheEntries {
+		c.evictLocked(now)
+	}
+	c.cache[key] = introspectionEntry{result: result, expires: expires}
+
+	return result, nil
+}
+
+// Validate introspects a token and returns its claims if it is an active
+// access token or API key that may be used with this service. Refresh tokens
+// are active too, but only the auth service may accept them.
+func (c *IntrospectionClient) Validate(ctx context.Context, token string) (*Claims, error) {
+	result, err := c.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Active {
+		return nil, ErrInactiveToken
+	}
+	if result.TokenType != TokenTypeAccess && result.TokenType != TokenTypeAPIKey {
+		return nil, ErrWrongTokenType
+	}
+	if !AcceptsAudience(result.Audience) {
+		return nil, ErrWrongAudience
+	}
+
+	return result.Claims(), nil
+}
+
+// fetch calls the introspection endpoint
+func (c *IntrospectionClient) fetch(ctx context.Context, token string) (*Introspection, error) {
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	logging.SetRequestID(req)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(APIKeyHeader, c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to introspect token: unexpected status %d", resp.StatusCode)
+	}
+
+	var result Introspection
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// evictLocked drops expired entries, or the whole cache if all are still
+// fresh. The caller must hold c.mu.
+func (c *IntrospectionClient) evictLocked(now time.Time) {
+	for key, entry := range c.cache {
+		if !now.Before(entry.expires) {
+			delete(c.cache, key)
+		}
+	}
+	if len(c.cache) >= maxIntrospectionCacheEntries {
+		c.cache = make(map[string]introspectionEntry)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionClientValidate(t *testing.T) {
+	SetAudience("orders")
+
+	results := map[string]Introspection{
+		"access":          {Active: true, TokenType: TokenTypeAccess, UserID: 7, Username: "ana"},
+		"api-key":         {Active: true, TokenType: TokenTypeAPIKey, ClientID: "3", Scope: "orders:read"},
+		"refresh":         {Active: true, TokenType: TokenTypeRefresh, UserID: 7, Username: "ana", Role: "admin"},
+		"untyped":         {Active: true, UserID: 7, Username: "ana"},
+		"unknown-type":    {Active: true, TokenType: "mfa_challenge", UserID: 7},
+		"inactive":        {Active: false},
+		"other-audience":  {Active: true, TokenType: TokenTypeAccess, ClientID: "3", Audience: []string{"inventory"}},
+		"own-audience":    {Active: true, TokenType: TokenTypeAccess, ClientID: "3", Audience: []string{"orders"}},
+		"refresh-for-own": {Active: true, TokenType: TokenTypeRefresh, Audience: []string{"orders"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(APIKeyHeader) != "service-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(results[r.FormValue("token")])
+	}))
+	defer server.Close()
+
+	client := NewIntrospectionClient(server.URL, "service-key", time.Minute)
+
+	tests := []struct {
+		token   string
+		wantErr error
+	}{
+		{"access", nil},
+		{"api-key", nil},
+		{"own-audience", nil},
+		{"refresh", ErrWrongTokenType},
+		{"refresh-for-own", ErrWrongTokenType},
+		{"untyped", ErrWrongTokenType},
+		{"unknown-type", ErrWrongTokenType},
+		{"inactive", ErrInactiveToken},
+		{"other-audience", ErrWrongAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			claims, err := client.Validate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims == nil {
+				t.Fatal("Validate() returned no claims")
+			}
+			if tt.wantErr != nil && claims != nil {
+				t.Errorf("Validate() returned claims %+v for a rejected token", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+const (
+	// defaultJWKSCacheTTL is how long a fetched JWKS is used before it is refreshed
+	defaultJWKSCacheTTL = 10 * time.Minute
+
+	// minJWKSRefreshInterval limits refetches triggered by unknown key IDs
+	minJWKSRefreshInterval = 30 * time.Second
+)
+
+// JWK is a single JSON Web Key as defined in RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA public key parameters
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP (Ed25519) public key parameters
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK encodes a public signing key as a JWK
+func NewJWK(kid, alg string, publicKey crypto.PublicKey) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: alg,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: alg,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// PublicKey decodes the public key described by the JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 key: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// JWKSVerifier is a KeySource that fetches public keys from a remote JWKS
+// endpoint and caches them. The set is refetched when the cache is stale or
+// when a token refers to an unknown key ID, e.g. right after a key rotation.
+type JWKSVerifier struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	fetchMu     sync.Mutex
+}
+
+// NewJWKSVerifier creates a new JWKSVerifier for the given JWKS URL
+func NewJWKSVerifier(url string, ttl time.Duration) *JWKSVerifier {
+	if ttl <= 0 {
+		ttl = defaultJWKSCacheTTL
+	}
+
+	return &JWKSVerifier{
+		url:    url,
+		ttl:    ttl,
+		client: tracing.NewClient(5 * time.Second),
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// Key returns the public key for a key ID
+func (v *JWKSVerifier) Key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	fresh := time.Since(v.fetchedAt) < v.ttl
+	v.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := v.refresh(ok); err != nil {
+		// Keep serving cached keys if the auth service is temporarily unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refresh refetches the key set. Refetches for unknown key IDs are rate
+// limited so that tokens with made-up kids cannot hammer the auth service.
+func (v *JWKSVerifier) refresh(known bool) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	v.mu.RLock()
+	fresh := time.Since(v.fetchedAt) < v.ttl
+	recent := time.Since(v.lastAttempt) < minJWKSRefreshInterval
+	v.mu.RUnlock()
+
+	// Another goroutine refreshed the set while we were waiting
+	if known && fresh {
+		return nil
+	}
+	if recent {
+		return nil
+	}
+
+	v.mu.Lock()
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	resp, err := v.client.Get(v.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ignaseim/bartenderapp/services/pkg/models"
+)
+
+// SigningKey is a private key used to sign tokens, identified by its kid
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+}
+
+// Signer issues tokens with the active signing key. All of its keys, including
+// inactive ones, are published in the JWKS so that tokens signed with a key
+// that is being rotated out keep validating until they expire.
+type Signer struct {
+	keys   map[string]SigningKey
+	active SigningKey
+}
+
+// NewSigner creates a Signer from a set of keys. activeKeyID selects the key
+// used for new tokens; it may be empty when there is exactly one key.
+func NewSigner(keys []SigningKey, activeKeyID string) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one signing key is required")
+	}
+
+	s := &Signer{keys: make(map[string]SigningKey, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key has no key ID")
+		}
+		if _, exists := s.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key ID %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+
+	if activeKeyID == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("active key ID is required when more than one signing key is configured")
+		}
+		activeKeyID = keys[0].ID
+	}
+
+	active, ok := s.keys[activeKeyID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeKeyID)
+	}
+	s.active = active
+
+	return s, nil
+}
+
+// LoadSignerFromDir loads every *.pem private key in dir. The file name without
+// extension is used as the key ID. RSA keys sign with RS256 and Ed25519 keys
+// with EdDSA.
+func LoadSignerFromDir(dir, activeKeyID string) (*Signer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+		}
+
+		key, err := ParseSigningKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", dir)
+	}
+
+	return NewSigner(keys, activeKeyID)
+}
+
+// ParseSigningKey parses a PEM encoded RSA or Ed25519 private key
+func ParseSigningKey(id string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return SigningKey{}, errors.New("RSA signing keys must be at least 2048 bits")
+		}
+		return SigningKey{ID: id, Method: jwt.SigningMethodRS256, PrivateKey: key}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: key}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+// NewEphemeralSigner creates a Signer with a freshly generated Ed25519 key.
+// Tokens it issues become invalid when the process exits, so it is only meant
+// for local development.
+func NewEphemeralSigner() (*Signer, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprintf("ephemeral-%d", time.Now().Unix())
+	return NewSigner([]SigningKey{{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: privateKey}}, id)
+}
+
+// NewSignerFromEnv loads the signing keys from JWT_SIGNING_KEYS_DIR, using
+// JWT_ACTIVE_KEY_ID as the active key. Without a key directory an ephemeral
+// key is generated.
+func NewSignerFromEnv() (*Signer, error) {
+	dir := os.Getenv("JWT_SIGNING_KEYS_DIR")
+	if dir == "" {
+		return NewEphemeralSigner()
+	}
+	return LoadSignerFromDir(dir, os.Getenv("JWT_ACTIVE_KEY_ID"))
+}
+
+// ActiveKeyID returns the ID of the key used to sign new tokens
+func (s *Signer) ActiveKeyID() string {
+	return s.active.ID
+}
+
+// Sign signs arbitrary claims with the active key and sets the kid header
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+
+	return token.SignedString(s.active.PrivateKey)
+}
+
+// TokenOptions customizes a token issued by GenerateToken
+type TokenOptions struct {
+	// Use marks tokens that are not access tokens, e.g. TokenUseMFAChallenge
+	Use string
+	// SessionID is the login (refresh token family) the token belongs to
+	SessionID string
+	// AuthMethods lists how the user authenticated (amr claim), e.g. "pwd", "otp"
+	AuthMethods []string
+	// TerminalID binds the token to the terminal it was issued on
+	TerminalID int
+	// Permissions are the permissions granted by the role of the user
+	Permissions []string
+	// Actor is the admin impersonating the user, if any
+	Actor *Actor
+	// TTL overrides the default lifetime of 24 hours
+	TTL time.Duration
+}
+
+// GenerateToken creates a new JWT token for a user. The token carries a unique
+// jti so that it can be revoked individually.
+func (s *Signer) GenerateToken(user models.User, opts TokenOptions) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+
+	// Create claims with user information
+	expirationTime := time.Now().Add(ttl)
+	claims := &Claims{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		Role:        user.Role,
+		SessionID:   opts.SessionID,
+		TokenUse:    opts.Use,
+		AuthMethods: opts.AuthMethods,
+		TerminalID:  opts.TerminalID,
+		Permissions: opts.Permissions,
+		Actor:       opts.Actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "bartenderapp",
+			Subject:   fmt.Sprintf("%d", user.ID),
+		},
+	}
+
+	return s.Sign(claims)
+}
+
+// ClientTokenOptions describe a token issued to a machine client with the
+// client credentials grant
+type ClientTokenOptions struct {
+	// ClientID and Name identify the client
+	ClientID int
+	Name     string
+	// Scopes granted to the token, a subset of the scopes of the client
+	Scopes []string
+	// Audience is the service the token may be used with
+	Audience string
+	// TTL overrides the default lifetime of 15 minutes
+	TTL time.Duration
+}
+
+// GenerateClientToken creates a short-lived access token for a machine client
+// calling another service. Its claims match those of the client's API key, so
+// services handle both alike, but the token is only accepted by its audience.
+func (s *Signer) GenerateClientToken(opts ClientTokenOptions) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = 15 * time.Minute
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Username: opts.Name,
+		Role:     RoleAPIClient,
+		ClientID: opts.ClientID,
+		Scopes:   opts.Scopes,
+		// Scopes are permissions, so RequirePermission treats clients and users alike
+		Permissions: opts.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "bartenderapp",
+			Subject:   fmt.Sprintf("client:%d", opts.ClientID),
+			Audience:  jwt.ClaimStrings{opts.Audience},
+		},
+	}
+
+	return s.Sign(claims)
+}
+
+// Key returns the public key for a key ID, so a Signer can also act as the
+// KeySource of the service that issues the tokens
+func (s *Signer) Key(kid string) (crypto.PublicKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// JWKS returns the public halves of all signing keys
+func (s *Signer) JWKS() JWKS {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := s.keys[id]
+		jwk, err := NewJWK(id, key.Method.Alg(), key.PrivateKey.Public())
+		if err != nil {
+			// Keys are validated when they are loaded
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,27 @@
+package auth
+
+// Permissions checked by the services. Roles grant them through the
+// role_permissions table, so new roles need no code changes.
+const (
+	PermUsersRead        = "users:read"
+	PermUsersWrite       = "users:write"
+	PermUsersDelete      = "users:delete"
+	PermUsersErase       = "users:erase"
+	PermUsersSecurity    = "users:security"
+	PermUsersImpersonate = "users:impersonate"
+	PermRolesManage      = "roles:manage"
+	PermTerminalsManage  = "terminals:manage"
+	PermAPIClientsManage = "api_clients:manage"
+	PermInventoryRead    = "inventory:read"
+	PermInventoryAdjust  = "inventory:adjust"
+	PermInventoryWrite   = "inventory:write"
+	PermRecipesRead      = "recipes:read"
+	PermRecipesWrite     = "recipes:write"
+	PermOrdersRead       = "orders:read"
+	PermOrdersCreate     = "orders:create"
+	PermOrdersProcess    = "orders:process"
+	PermOrdersRefund     = "orders:refund"
+	PermReportsRead      = "reports:read"
+	PermAuditRead        = "audit:read"
+	PermTokensIntrospect = "tokens:introspect"
+)
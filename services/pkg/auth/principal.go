@@ -0,0 +1,85 @@
+package auth
+
+import "context"
+
+// Methods a principal can authenticate with
+const (
+	AuthMethodJWT           = "jwt"
+	AuthMethodAPIKey        = "api_key"
+	AuthMethodImpersonation = "impersonation"
+)
+
+// Principal is the authenticated caller of a request: a user, a machine
+// client or an admin acting as a user. middleware.Authenticate adds it to the
+// request context; handlers get it with FromContext.
+type Principal struct {
+	UserID      int
+	ClientID    int
+	Username    string
+	Role        string
+	Permissions []string
+	AuthMethod  string
+	RequestID   string
+
+	// Actor is the admin acting as the user of an impersonation token
+	Actor *Actor
+
+	// Claims are the validated claims the principal was built from, for
+	// services that take claims
+	Claims *Claims
+}
+
+// principalKey is the context key of the principal. Being unexported, no
+// other package can add or overwrite a principal without WithPrincipal.
+type principalKey struct{}
+
+// NewPrincipal creates the principal of validated claims. Claims of
+// impersonation tokens always get AuthMethodImpersonation.
+func NewPrincipal(claims *Claims, authMethod, requestID string) *Principal {
+	if claims.Impersonated() {
+		authMethod = AuthMethodImpersonation
+	}
+
+	return &Principal{
+		UserID:      claims.UserID,
+		ClientID:    claims.ClientID,
+		Username:    claims.Username,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		AuthMethod:  authMethod,
+		RequestID:   requestID,
+		Actor:       claims.Actor,
+		Claims:      claims,
+	}
+}
+
+// WithPrincipal returns a copy of ctx that carries the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of an authenticated request
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// HasRole checks if the principal has one of the roles
+func (p *Principal) HasRole(roles ...string) bool {
+	return HasRole(p.Claims, roles...)
+}
+
+// HasPermission checks if the principal has one of the permissions
+func (p *Principal) HasPermission(permissions ...string) bool {
+	return HasPermission(p.Claims, permissions...)
+}
+
+// Impersonated reports whether an admin is acting as the principal's user
+func (p *Principal) Impersonated() bool {
+	return p.AuthMethod == AuthMethodImpersonation
+}
+
+// OnTerminal reports whether the principal logged in with a PIN on a terminal
+func (p *Principal) OnTerminal() bool {
+	return p.Claims != nil && p.Claims.OnTerminal()
+}
@@ -0,0 +1,29 @@
+// Package csvutil helps writing CSV exports that are opened in spreadsheet
+// programs.
+package csvutil
+
+import "strings"
+
+// formulaPrefixes are the characters that make spreadsheet programs treat a
+// cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// Escape neutralizes a cell that would be read as a formula by prefixing it
+// with a single quote, so values from users such as usernames cannot run
+// formulas in the spreadsheet of whoever opens the export. Other values are
+// returned as they are.
+func Escape(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Unescape reverses Escape for values read back from an export, e.g. when an
+// edited export is imported again
+func Unescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
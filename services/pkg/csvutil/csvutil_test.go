@@ -0,0 +1,56 @@
+package csvutil
+
+import "testing"
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"ana", "ana"},
+		{"ana@example.com", "ana@example.com"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{" =1", " =1"},
+		{"'quoted", "'quoted"},
+	}
+
+	for _, tt := range tests {
+		if got := Escape(tt.value); got != tt.want {
+			t.Errorf("Escape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"'", "'"},
+		{"ana", "ana"},
+		{"'quoted", "'quoted"},
+		{"'=1+1", "=1+1"},
+		{"'-2", "-2"},
+		{"'@SUM(A1)", "@SUM(A1)"},
+		{"=1+1", "=1+1"},
+	}
+
+	for _, tt := range tests {
+		if got := Unescape(tt.value); got != tt.want {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"=1+1", "-2", "ana", "'quoted", "\t=1"} {
+		if got := Unescape(Escape(value)); got != value {
+			t.Errorf("Unescape(Escape(%q)) = %q", value, got)
+		}
+	}
+}
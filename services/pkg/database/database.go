@@ -3,11 +3,12 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+	"github.com/lib/pq"
 )
 
 // Config holds database connection parameters
@@ -39,11 +40,13 @@ func Connect(config Config) (*sql.DB, error) {
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
 	)
 
-	// Open a connection to the database
-	db, err := sql.Open("postgres", dsn)
+	// Open a connection to the database. Queries run with a request context
+	// get spans in its trace.
+	connector, err := pq.NewConnector(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	db := sql.OpenDB(tracing.WrapConnector(connector))
 
 	// Set connection pool settings
 	db.SetMaxOpenConns(25)
@@ -55,7 +58,7 @@ func Connect(config Config) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Printf("Connected to PostgreSQL database at %s:%s", config.Host, config.Port)
+	slog.Info("Connected to PostgreSQL database", "host", config.Host, "port", config.Port)
 	return db, nil
 }
 
@@ -72,7 +75,7 @@ func getEnv(key, defaultValue string) string {
 func Close(db *sql.DB) {
 	if db != nil {
 		if err := db.Close(); err != nil {
-			log.Printf("Error closing database connection: %v", err)
+			slog.Error("Error closing database connection", "error", err)
 		}
 	}
 } 
\ No newline at end of file
@@ -0,0 +1,105 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/tracing"
+)
+
+// DB checks that the database answers a ping within timeout
+func DB(db *sql.DB, timeout time.Duration) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		if err := db.PingContext(ctx); err != nil {
+			return fmt.Errorf("database ping failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// NATS checks that a NATS server of natsURL accepts connections and greets
+// with its INFO line. natsURL may list several servers separated by commas,
+// like NATS_URL; one reachable server is enough.
+func NATS(natsURL string, timeout time.Duration) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var err error
+		for _, server := range strings.Split(natsURL, ",") {
+			if err = pingNATS(ctx, strings.TrimSpace(server)); err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// pingNATS connects to one NATS server and reads its INFO line
+func pingNATS(ctx context.Context, server string) error {
+	address := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		address = u.Host
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "4222")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read NATS greeting: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.New("unexpected NATS greeting")
+	}
+	return nil
+}
+
+// HTTP checks that a downstream service answers a GET of target with a 2xx
+// status within timeout. Point it at the /livez of other services rather than
+// their /readyz, so one failing dependency does not take every service out.
+func HTTP(target string, timeout time.Duration) Checker {
+	client := tracing.NewClient(timeout)
+
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return fmt.Errorf("invalid health check URL: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
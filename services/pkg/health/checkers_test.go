@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeNATS accepts connections and greets each with greeting
+func fakeNATS(t *testing.T, greeting string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greeting))
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// closedAddress returns an address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestNATS(t *testing.T) {
+	server := fakeNATS(t, "INFO {\"server_id\":\"test\"}\r\n")
+	other := fakeNATS(t, "-ERR 'Authorization Violation'\r\n")
+	closed := closedAddress(t)
+
+	tests := []struct {
+		name    string
+		natsURL string
+		wantErr bool
+	}{
+		{"nats URL", "nats://" + server, false},
+		{"host and port", server, false},
+		{"first of several down", "nats://" + closed + ", nats://" + server, false},
+		{"unreachable", "nats://" + closed, true},
+		{"not a NATS server", "nats://" + other, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NATS(tt.natsURL, time.Second).Check(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/livez":
+			w.WriteHeader(http.StatusOK)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr bool
+	}{
+		{"up", server.URL + "/livez", false},
+		{"unavailable", server.URL + "/readyz", true},
+		{"too slow", server.URL + "/slow", true},
+		{"unreachable", "http://" + closedAddress(t) + "/livez", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := HTTP(tt.target, 50*time.Millisecond).Check(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
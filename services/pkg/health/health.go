@@ -0,0 +1,198 @@
+// Package health provides the liveness and readiness probes of the services.
+// /livez reports that the process is up; /readyz runs the registered
+// checks of the dependencies a service cannot work without, such as the
+// database, and fails while any of them does.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+)
+
+// Statuses of a report and of single checks
+const (
+	StatusOK          = "ok"
+	StatusFailing     = "failing"
+	StatusUnavailable = "unavailable"
+)
+
+// Checker checks a dependency of a service. Check must return once ctx is
+// done.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// CheckResult is the outcome of one check. Error is only logged, the probes
+// are public and must not reveal internal addresses or driver messages.
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"-"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the response of the health endpoints
+type Report struct {
+	Status    string                 `json:"status"`
+	Version   string                 `json:"version"`
+	Commit    string                 `json:"commit"`
+	Uptime    string                 `json:"uptime"`
+	CheckedAt *time.Time             `json:"checked_at,omitempty"`
+	Checks    map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// namedCheck is a registered checker
+type namedCheck struct {
+	name    string
+	checker Checker
+}
+
+// Health runs the readiness checks of a service and serves the probes.
+// Check results are cached for the cache TTL, so frequent probes from
+// Docker, Kubernetes and load balancers do not hammer the dependencies.
+type Health struct {
+	version  string
+	commit   string
+	started  time.Time
+	cacheTTL time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	checks   []namedCheck
+	cached   *Report
+	cachedAt time.Time
+}
+
+// New creates the health of a service of the given build version and commit.
+// Results of the readiness checks are reused for cacheTTL; every check gets
+// at most timeout unless the checker has a shorter one.
+func New(version, commit string, cacheTTL, timeout time.Duration) *Health {
+	return &Health{
+		version:  version,
+		commit:   commit,
+		started:  time.Now(),
+		cacheTTL: cacheTTL,
+		timeout:  timeout,
+	}
+}
+
+// Register adds a readiness check under name. Register all checks before
+// serving requests.
+func (h *Health) Register(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, checker: checker})
+	h.cached = nil
+}
+
+// Live serves /livez. It only reports that the process handles requests, so
+// a failing dependency does not get the service restarted.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	middleware.RespondWithJSON(w, http.StatusOK, h.report(StatusOK))
+}
+
+// Ready serves /readyz. It answers 503 while any check fails, so traffic is
+// only routed to instances that can handle it. Each check is listed with its
+// status and duration.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	middleware.RespondWithJSON(w, status, report)
+}
+
+// Check runs the readiness checks concurrently, or returns the cached report
+// if it is recent enough
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached != nil && time.Since(h.cachedAt) < h.cacheTTL {
+		report := *h.cached
+		report.Uptime = h.uptime()
+		return report
+	}
+
+	results := make([]CheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	checkedAt := time.Now().UTC()
+	report := h.report(StatusOK)
+	report.CheckedAt = &checkedAt
+	report.Checks = make(map[string]CheckResult, len(h.checks))
+
+	for i, check := range h.checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	h.cached = &report
+	h.cachedAt = time.Now()
+
+	return report
+}
+
+// run runs one check within the timeout
+func (h *Health) run(ctx context.Context, check namedCheck) CheckResult {
+	// Probes are cached for all callers, so a caller hanging up must not
+	// fail the checks of the others
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.checker.Check(ctx)
+
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		slog.Warn("Health check failed", "check", check.name, "error", err)
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// report returns a report without checks
+func (h *Health) report(status string) Report {
+	return Report{
+		Status:  status,
+		Version: h.version,
+		Commit:  h.commit,
+		Uptime:  h.uptime(),
+	}
+}
+
+// uptime returns how long the service has been running, in whole seconds
+func (h *Health) uptime() string {
+	return time.Since(h.started).Truncate(time.Second).String()
+}
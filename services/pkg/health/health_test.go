@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	passing := CheckerFunc(func(context.Context) error { return nil })
+	failing := CheckerFunc(func(context.Context) error {
+		return errors.New("dial tcp 10.0.3.7:5432: connection refused")
+	})
+
+	tests := []struct {
+		name       string
+		checks     map[string]Checker
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{"no checks", nil, http.StatusOK, nil},
+		{"passing", map[string]Checker{"database": passing}, http.StatusOK, map[string]string{"database": StatusOK}},
+		{
+			"failing",
+			map[string]Checker{"database": failing, "nats": passing},
+			http.StatusServiceUnavailable,
+			map[string]string{"database": StatusFailing, "nats": StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New("v1.2.3", "abc123", time.Minute, time.Second)
+			for name, checker := range tt.checks {
+				h.Register(name, checker)
+			}
+
+			rec := httptest.NewRecorder()
+			h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if body := rec.Body.String(); strings.Contains(body, "10.0.3.7") || strings.Contains(body, "error") {
+				t.Errorf("response reveals the check error: %s", body)
+			}
+
+			var report Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Version != "v1.2.3" || report.Commit != "abc123" {
+				t.Errorf("version = %q, commit = %q", report.Version, report.Commit)
+			}
+			if len(report.Checks) != len(tt.wantChecks) {
+				t.Fatalf("got %d checks, want %d", len(report.Checks), len(tt.wantChecks))
+			}
+			for name, want := range tt.wantChecks {
+				if got := report.Checks[name].Status; got != want {
+					t.Errorf("check %s status = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLiveSkipsChecks(t *testing.T) {
+	h := New("dev", "unknown", time.Minute, time.Second)
+	h.Register("database", CheckerFunc(func(context.Context) error {
+		t.Error("Live() ran a check")
+		return errors.New("down")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.Live(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCheckCachesResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		cacheTTL time.Duration
+		want     int32
+	}{
+		{"cached", time.Minute, 1},
+		{"expired", 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			h := New("dev", "unknown", tt.cacheTTL, time.Second)
+			h.Register("database", CheckerFunc(func(context.Context) error {
+				calls.Add(1)
+				return nil
+			}))
+
+			for i := 0; i < 3; i++ {
+				h.Check(context.Background())
+			}
+
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("check ran %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimesOut(t *testing.T) {
+	h := New("dev", "unknown", time.Minute, 10*time.Millisecond)
+	h.Register("slow", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	report := h.Check(context.Background())
+	if report.Status != StatusUnavailable || report.Checks["slow"].Status != StatusFailing {
+		t.Errorf("report = %+v, want the slow check failing", report)
+	}
+}
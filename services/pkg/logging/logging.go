@@ -0,0 +1,112 @@
+// Package logging provides the structured JSON logs of the services. Every
+// log line of a request carries its request ID, route and caller, so one
+// request can be followed across services by its X-Request-ID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ParseLevel parses a log level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+}
+
+// New creates a logger that writes JSON lines of level and above to w
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Setup makes a JSON logger on stdout the default logger of the service.
+// LOG_LEVEL selects the level (info). Lines written with the log package
+// end up in the same JSON stream.
+func Setup(service string) *slog.Logger {
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+
+	logger := New(os.Stdout, level).With("service", service)
+	slog.SetDefault(logger)
+
+	if err != nil {
+		logger.Warn("Invalid LOG_LEVEL, using info", "error", err)
+	}
+
+	return logger
+}
+
+// loggerKey is the context key of the logger
+type loggerKey struct{}
+
+// requestKey is the context key of the requestScope
+type requestKey struct{}
+
+// requestScope holds the attributes of one request. It is shared by all
+// contexts derived from the request, so middleware further down the chain,
+// such as authentication, can add the caller to the access log line.
+type requestScope struct {
+	id    string
+	mu    sync.Mutex
+	attrs []any
+}
+
+// NewContext returns a copy of ctx that logs with logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of ctx with the attributes of its request,
+// or the default logger outside of requests
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+
+	if scope, ok := ctx.Value(requestKey{}).(*requestScope); ok {
+		scope.mu.Lock()
+		attrs := scope.attrs
+		scope.mu.Unlock()
+		logger = logger.With(attrs...)
+	}
+
+	return logger
+}
+
+// AddAttrs adds key-value pairs to every later log line of the request of
+// ctx, e.g. the user ID once it is known. Outside of requests it does nothing.
+func AddAttrs(ctx context.Context, args ...any) {
+	scope, ok := ctx.Value(requestKey{}).(*requestScope)
+	if !ok {
+		return
+	}
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+
+	// Copy so loggers handed out earlier keep their attributes
+	scope.attrs = append(scope.attrs[:len(scope.attrs):len(scope.attrs)], args...)
+}
+
+// RequestIDFromContext returns the ID of the request of ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	if scope, ok := ctx.Value(requestKey{}).(*requestScope); ok {
+		return scope.id
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header that carries the ID of a request across services
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken over from callers
+const maxRequestIDLength = 128
+
+// WithRequestID returns a copy of ctx for a request with the given ID. Log
+// lines written with FromContext carry the ID as request_id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &requestScope{
+		id:    id,
+		attrs: []any{"request_id", id},
+	})
+}
+
+// RequestID takes over the X-Request-ID of the caller, or creates one for
+// requests that start here, and adds it to the request context and the
+// response. It should be the first middleware of a service.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// SetRequestID passes the request ID of the request context on to another
+// service. Call it on outgoing requests made while handling a request.
+func SetRequestID(req *http.Request) {
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII characters up to
+// maxRequestIDLength, so callers cannot inject line breaks into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
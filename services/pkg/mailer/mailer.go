@@ -0,0 +1,178 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text e-mail
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers e-mails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewFromEnv creates the Mailer selected by MAIL_DRIVER: "smtp", "file" or
+// "log" (the default, meant for local development)
+func NewFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "BartenderApp <no-reply@bartenderapp.local>"
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(host, port),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: from}, nil
+	case "", "log":
+		return &LogMailer{From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// SMTPMailer sends e-mails through an SMTP server, using STARTTLS when the
+// server offers it and PLAIN authentication when a username is set
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Mailer
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	if err := smtp.SendMail(m.Addr, auth, address(m.From), []string{msg.To}, format(m.From, msg)); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
+
+// LogMailer writes e-mails to the service log instead of sending them. The
+// query of links is redacted, since reset and invitation links carry live
+// tokens and logs are read by more people than mailboxes; use FileMailer to
+// open the links locally.
+type LogMailer struct {
+	From string
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(msg Message) error {
+	slog.Info("Mail", "to", msg.To, "subject", msg.Subject, "body", redactLinks(msg.Body))
+	return nil
+}
+
+// linkPattern matches the links of a mail body
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// redactLinks replaces the query and fragment of links in body
+func redactLinks(body string) string {
+	return linkPattern.ReplaceAllStringFunc(body, func(link string) string {
+		u, err := url.Parse(link)
+		if err != nil {
+			return "[redacted link]"
+		}
+		if u.RawQuery == "" && u.Fragment == "" {
+			return link
+		}
+
+		u.RawQuery, u.Fragment = "", ""
+		return u.String() + "?[redacted]"
+	})
+}
+
+// FileMailer writes each e-mail as an .eml file into a directory, so that
+// local development can open them in a mail client
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Send implements Mailer
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.seq++
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), m.seq)
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
+
+// format renders a message in RFC 5322 format
+func format(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// headerValue strips line breaks so that values cannot inject headers
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// address extracts the bare address from "Name <address>"
+func address(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.LastIndex(from, ">"); end > start {
+			return from[start+1 : end]
+		}
+	}
+	return from
+}
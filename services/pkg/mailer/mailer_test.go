@@ -0,0 +1,40 @@
+package mailer
+
+import "testing"
+
+func TestRedactLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"reset link",
+			"Open the link below.\n\nhttp://localhost:3000/reset-password?token=abc123\n\nBye",
+			"Open the link below.\n\nhttp://localhost:3000/reset-password?[redacted]\n\nBye",
+		},
+		{
+			"several parameters and fragment",
+			"https://app.example.com/invite?a=1&token=secret#x",
+			"https://app.example.com/invite?[redacted]",
+		},
+		{
+			"link without query",
+			"See https://example.com/help for help",
+			"See https://example.com/help for help",
+		},
+		{
+			"no links",
+			"token=abc123",
+			"token=abc123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactLinks(tt.body); got != tt.want {
+				t.Errorf("redactLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Login methods
+const (
+	LoginPassword = "password"
+	LoginMFA      = "mfa"
+	LoginPIN      = "pin"
+	LoginOIDC     = "oidc"
+)
+
+var (
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Number of logins, by method and result (succeeded or failed).",
+	}, []string{"method", "result"})
+
+	ordersPlaced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_placed_total",
+		Help: "Number of orders placed.",
+	})
+
+	orderValue = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_value_cents_total",
+		Help: "Total value of the orders placed in cents.",
+	})
+
+	stockMovements = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stock_movements_total",
+		Help: "Number of stock movements, by type.",
+	}, []string{"type"})
+
+	stockMoved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stock_movement_ml_total",
+		Help: "Quantity moved in stock movements in millilitres, by type.",
+	}, []string{"type"})
+)
+
+// LoginSucceeded counts a successful login with the given method
+func LoginSucceeded(method string) {
+	logins.WithLabelValues(method, "succeeded").Inc()
+}
+
+// LoginFailed counts a failed login with the given method
+func LoginFailed(method string) {
+	logins.WithLabelValues(method, "failed").Inc()
+}
+
+// OrderPlaced counts a placed order and its value in cents
+func OrderPlaced(valueCents int64) {
+	ordersPlaced.Inc()
+	orderValue.Add(float64(valueCents))
+}
+
+// StockMoved counts a stock movement of the given type, such as delivery,
+// sale or waste, and the quantity moved in millilitres. The quantity counts
+// as positive whatever the direction of the movement.
+func StockMoved(kind string, quantityML float64) {
+	stockMovements.WithLabelValues(kind).Inc()
+	if quantityML < 0 {
+		quantityML = -quantityML
+	}
+	stockMoved.WithLabelValues(kind).Add(quantityML)
+}
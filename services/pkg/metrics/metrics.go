@@ -0,0 +1,59 @@
+// Package metrics provides the Prometheus metrics of the services: HTTP
+// request counts, latencies and in-flight requests per route, and counters
+// for business events such as logins, orders and stock movements.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ignaseim/bartenderapp/services/pkg/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests, by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests in seconds, by route template, method and status.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "method", "status"})
+
+	httpInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being served, by route template and method.",
+	}, []string{"route", "method"})
+)
+
+// Middleware records the count, duration and status of requests. Requests
+// are labelled with their route template rather than the path, so
+// /users/1 and /users/2 share one series. Register it with router.Use.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := middleware.RouteTemplate(r)
+
+		inFlight := httpInFlight.WithLabelValues(route, r.Method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		lrw := middleware.NewLoggingResponseWriter(w)
+		next.ServeHTTP(lrw, r)
+
+		status := strconv.Itoa(lrw.StatusCode())
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Handler serves the metrics for Prometheus to scrape
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -1,39 +1,59 @@
 package middleware
 
 import (
-	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
 )
 
-// RequestLogger logs information about each HTTP request
+// RequestLogger logs information about each HTTP request. Log lines of the
+// request carry its route template, such as /users/{id}, so requests to one
+// endpoint can be found together. It must run after logging.RequestID.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		
+		logging.AddAttrs(r.Context(), "route", RouteTemplate(r))
+		
 		// Wrap the response writer to capture status code
 		lrw := NewLoggingResponseWriter(w)
 		
 		// Call the next handler
 		next.ServeHTTP(lrw, r)
 		
-		// Log the request details
-		log.Printf(
-			"method=%s path=%s status=%d duration=%s ip=%s user_agent=%s",
-			r.Method,
-			r.URL.Path,
-			lrw.statusCode,
-			time.Since(start),
-			r.RemoteAddr,
-			r.UserAgent(),
+		// Log the request details. The route attribute stands in for the
+		// path, which can carry secrets such as invitation tokens.
+		logging.FromContext(r.Context()).Info(
+			"request",
+			"method", r.Method,
+			"status", lrw.statusCode,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", ClientIP(r),
+			"user_agent", r.UserAgent(),
 		)
 	})
 }
 
+// RouteTemplate returns the template of the gorilla/mux route a request
+// matched, such as /users/{id}, or "unmatched" outside of routes. Unlike the
+// path it does not grow with every ID, so it suits logs and metric labels.
+func RouteTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
 // LoggingResponseWriter wraps http.ResponseWriter to capture status code
 type LoggingResponseWriter struct {
 	http.ResponseWriter
@@ -51,25 +71,55 @@ func (lrw *LoggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// Authenticate validates the JWT token and adds user info to the request context
+// StatusCode returns the status code written so far
+func (lrw *LoggingResponseWriter) StatusCode() int {
+	return lrw.statusCode
+}
+
+// Authenticate validates the JWT token, rejecting revoked tokens, and adds user info to the request context.
+// Machine clients may send an API key in the X-API-Key header instead; their claims carry the client ID and scopes.
 func Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from request
-		token, err := auth.ExtractTokenFromRequest(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+		var claims *auth.Claims
+		authMethod := auth.AuthMethodJWT
 		
-		// Validate token
-		claims, err := auth.ValidateToken(token)
-		if err != nil {
-			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
-			return
+		if apiKey := r.Header.Get(auth.APIKeyHeader); apiKey != "" {
+			authMethod = auth.AuthMethodAPIKey
+			
+			// Validate API key
+			var err error
+			claims, err = auth.ValidateAPIKey(r.Context(), apiKey)
+			if err != nil {
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+		} else {
+			// Extract token from request
+			token, err := auth.ExtractTokenFromRequest(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			
+			// Validate token
+			claims, err = auth.ValidateToken(r.Context(), token)
+			if err != nil {
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
 		}
 		
-		// Add claims to request context
-		ctx := context.WithValue(r.Context(), "claims", claims)
+		// Add the caller to request context and its log lines
+		principal := auth.NewPrincipal(claims, authMethod, logging.RequestIDFromContext(r.Context()))
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		if claims.ClientID != 0 {
+			logging.AddAttrs(ctx, "client_id", claims.ClientID)
+		} else {
+			logging.AddAttrs(ctx, "user_id", claims.UserID)
+		}
+		if claims.Actor != nil {
+			logging.AddAttrs(ctx, "actor_id", claims.Actor.UserID)
+		}
 		
 		// Call the next handler with updated context
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -80,15 +130,15 @@ func Authenticate(next http.Handler) http.Handler {
 func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get claims from context
-			claims, ok := r.Context().Value("claims").(*auth.Claims)
+			// Get the caller from context
+			principal, ok := auth.FromContext(r.Context())
 			if !ok {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 			
 			// Check if user has one of the required roles
-			if !auth.HasRole(claims, roles...) {
+			if !principal.HasRole(roles...) {
 				http.Error(w, "Forbidden - Insufficient permissions", http.StatusForbidden)
 				return
 			}
@@ -99,13 +149,65 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequirePermission checks if the user or machine client has one of the required permissions
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Get the caller from context
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			
+			// Check if the caller has one of the required permissions
+			if !principal.HasPermission(permissions...) {
+				http.Error(w, "Forbidden - Insufficient permissions", http.StatusForbidden)
+				return
+			}
+			
+			// Call the next handler
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DenyImpersonation rejects requests made with an impersonation token. It
+// guards destructive endpoints, such as deleting users or changing
+// credentials, that an admin acting as a user must not reach.
+func DenyImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := auth.FromContext(r.Context()); ok && principal.Impersonated() {
+			RespondWithError(w, http.StatusForbidden, "Not allowed while impersonating a user")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// DenyTerminal rejects requests made with the token of a PIN login on a
+// terminal. Such tokens are meant for taking orders on a shared device, not
+// for changing accounts or credentials.
+func DenyTerminal(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := auth.FromContext(r.Context()); ok && principal.OnTerminal() {
+			RespondWithError(w, http.StatusForbidden, "Not allowed with a terminal login")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 // CORS middleware adds CORS headers to the response
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Terminal-Key, X-API-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -133,7 +235,7 @@ func RespondWithJSON(w http.ResponseWriter, status int, data interface{}) {
 	
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			log.Printf("Error encoding JSON response: %v", err)
+			slog.Error("Error encoding JSON response", "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 	}
@@ -142,4 +244,24 @@ func RespondWithJSON(w http.ResponseWriter, status int, data interface{}) {
 // RespondWithError sends an error response
 func RespondWithError(w http.ResponseWriter, status int, message string) {
 	RespondWithJSON(w, status, map[string]string{"error": message})
-} 
\ No newline at end of file
+} 
+
+// ClientIP returns the IP address of the client that made the request.
+// X-Forwarded-For and X-Real-IP are only honored when TRUST_PROXY_HEADERS is
+// "true", since clients can set them freely when the service is exposed directly.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
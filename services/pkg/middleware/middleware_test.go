@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/pkg/auth"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+)
+
+func TestRequestLoggerLogsRouteNotPath(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(previous)
+
+	router := mux.NewRouter()
+	router.Use(logging.RequestID)
+	router.Use(RequestLogger)
+	router.HandleFunc("/invitations/{token}/accept", func(w http.ResponseWriter, r *http.Request) {})
+
+	const token = "secret-invite-token"
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/invitations/"+token+"/accept", nil))
+
+	line := buf.String()
+	if strings.Contains(line, token) {
+		t.Errorf("access log contains the token: %s", line)
+	}
+	if !strings.Contains(line, `"route":"/invitations/{token}/accept"`) {
+		t.Errorf("access log lacks the route: %s", line)
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	user := &auth.Claims{UserID: 7, Username: "ana"}
+	impersonated := &auth.Claims{UserID: 7, Username: "ana", Actor: &auth.Actor{UserID: 1, Username: "admin"}}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      int
+	}{
+		{"user", auth.NewPrincipal(user, auth.AuthMethodJWT, ""), http.StatusOK},
+		{"api key", auth.NewPrincipal(&auth.Claims{ClientID: 3}, auth.AuthMethodAPIKey, ""), http.StatusOK},
+		{"impersonation", auth.NewPrincipal(impersonated, auth.AuthMethodJWT, ""), http.StatusForbidden},
+		{"no principal", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := DenyImpersonation(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api-clients", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyTerminal(t *testing.T) {
+	user := &auth.Claims{UserID: 7, Username: "ana"}
+	terminal := &auth.Claims{UserID: 7, Username: "ana", TokenUse: auth.TokenUseTerminal, TerminalID: 2}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      int
+	}{
+		{"user", auth.NewPrincipal(user, auth.AuthMethodJWT, ""), http.StatusOK},
+		{"api key", auth.NewPrincipal(&auth.Claims{ClientID: 3}, auth.AuthMethodAPIKey, ""), http.StatusOK},
+		{"terminal", auth.NewPrincipal(terminal, auth.AuthMethodJWT, ""), http.StatusForbidden},
+		{"no principal", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := DenyTerminal(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/users/7", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
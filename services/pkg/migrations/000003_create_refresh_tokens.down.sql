@@ -0,0 +1,3 @@
+-- Migration: drop refresh token store
+
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,19 @@
+-- Migration: server-side refresh token store
+
+-- Refresh tokens table. Only a SHA-256 hash of each token is stored. Tokens
+-- issued from the same login share a family_id so that the whole chain can be
+-- revoked when an already-rotated token is presented again.
+CREATE TABLE refresh_tokens (
+  token_id    SERIAL PRIMARY KEY,
+  user_id     INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  family_id   UUID NOT NULL,
+  token_hash  TEXT UNIQUE NOT NULL,
+  expires_at  TIMESTAMPTZ NOT NULL,
+  rotated_at  TIMESTAMPTZ,
+  revoked_at  TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ DEFAULT now()
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,4 @@
+-- Migration: drop access token denylist
+
+DROP TABLE IF EXISTS user_token_revocations;
+DROP TABLE IF EXISTS revoked_tokens;
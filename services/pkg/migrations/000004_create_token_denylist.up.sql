@@ -0,0 +1,20 @@
+-- Migration: access token denylist
+
+-- Individually revoked access tokens, keyed by their jti claim. Rows can be
+-- purged once expires_at has passed because the token is no longer valid anyway.
+CREATE TABLE revoked_tokens (
+  jti         TEXT PRIMARY KEY,
+  user_id     INT REFERENCES users(user_id) ON DELETE CASCADE,
+  expires_at  TIMESTAMPTZ NOT NULL,
+  revoked_at  TIMESTAMPTZ DEFAULT now()
+);
+
+-- Per-user revocation cutoff. Every token issued to the user at or before
+-- revoked_before is rejected.
+CREATE TABLE user_token_revocations (
+  user_id         INT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+  revoked_before  TIMESTAMPTZ NOT NULL
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
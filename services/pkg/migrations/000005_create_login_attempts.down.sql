@@ -0,0 +1,3 @@
+-- Migration: drop failed login tracking
+
+DROP TABLE IF EXISTS login_attempts;
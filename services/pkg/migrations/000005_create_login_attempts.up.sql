@@ -0,0 +1,15 @@
+-- Migration: failed login tracking
+
+-- Failed login attempts per scope ('user' keyed by username, 'ip' keyed by
+-- client IP). Failures older than the tracking window are forgotten.
+CREATE TABLE login_attempts (
+  scope           TEXT NOT NULL CHECK (scope IN ('user', 'ip')),
+  attempt_key     TEXT NOT NULL,
+  failures        INT NOT NULL DEFAULT 0,
+  last_failed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until    TIMESTAMPTZ,
+  PRIMARY KEY (scope, attempt_key)
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);
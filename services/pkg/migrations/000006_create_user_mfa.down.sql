@@ -0,0 +1,4 @@
+-- Migration: drop TOTP two-factor authentication
+
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
@@ -0,0 +1,21 @@
+-- Migration: TOTP two-factor authentication
+
+-- TOTP enrollment per user. enabled_at stays NULL until the user confirms the
+-- secret with a valid code. last_used_step prevents replaying a code.
+CREATE TABLE user_mfa (
+  user_id         INT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+  totp_secret     TEXT NOT NULL,
+  enabled_at      TIMESTAMPTZ,
+  last_used_step  BIGINT NOT NULL DEFAULT 0,
+  created_at      TIMESTAMPTZ DEFAULT now()
+);
+
+-- Single-use recovery codes, stored as SHA-256 hashes
+CREATE TABLE mfa_recovery_codes (
+  code_id     SERIAL PRIMARY KEY,
+  user_id     INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  code_hash   TEXT NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ DEFAULT now(),
+  UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,4 @@
+-- Migration: drop quick PIN login
+
+DROP TABLE IF EXISTS terminals;
+ALTER TABLE users DROP COLUMN IF EXISTS pin_hash;
@@ -0,0 +1,17 @@
+-- Migration: quick PIN login on registered terminals
+
+-- Hashed numeric PIN for quick login on shared terminals
+ALTER TABLE users ADD COLUMN pin_hash TEXT;
+
+-- Registered POS terminals. Terminals authenticate with a key that is only
+-- shown once; the prefix is stored in clear text to look the key up.
+CREATE TABLE terminals (
+  terminal_id   SERIAL PRIMARY KEY,
+  name          TEXT NOT NULL,
+  key_prefix    TEXT UNIQUE NOT NULL,
+  key_hash      TEXT NOT NULL,
+  created_by    INT REFERENCES users(user_id) ON DELETE SET NULL,
+  created_at    TIMESTAMPTZ DEFAULT now(),
+  last_seen_at  TIMESTAMPTZ,
+  revoked_at    TIMESTAMPTZ
+);
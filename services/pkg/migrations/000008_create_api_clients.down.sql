@@ -0,0 +1,3 @@
+-- Migration: drop API key credentials
+
+DROP TABLE IF EXISTS api_clients;
@@ -0,0 +1,16 @@
+-- Migration: API key credentials for machine clients
+
+-- Machine clients such as POS terminals, printer bridges or reporting jobs.
+-- Only the hash of the API key is stored; the prefix is used to look it up.
+CREATE TABLE api_clients (
+  client_id     SERIAL PRIMARY KEY,
+  name          TEXT NOT NULL,
+  scopes        TEXT[] NOT NULL DEFAULT '{}',
+  key_prefix    TEXT UNIQUE NOT NULL,
+  key_hash      TEXT NOT NULL,
+  created_by    INT REFERENCES users(user_id) ON DELETE SET NULL,
+  created_at    TIMESTAMPTZ DEFAULT now(),
+  last_used_at  TIMESTAMPTZ,
+  expires_at    TIMESTAMPTZ,
+  revoked_at    TIMESTAMPTZ
+);
@@ -0,0 +1,11 @@
+-- Migration: drop roles and permissions
+
+-- Users with custom roles cannot be kept under the original constraint
+UPDATE users SET role = 'guest' WHERE role NOT IN ('admin', 'bartender', 'guest');
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'bartender', 'guest'));
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
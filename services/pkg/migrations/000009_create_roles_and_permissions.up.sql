@@ -0,0 +1,68 @@
+-- Migration: roles and fine-grained permissions
+
+-- Roles users can have. System roles are required by the application and
+-- cannot be deleted.
+CREATE TABLE roles (
+  role_name    TEXT PRIMARY KEY,
+  description  TEXT NOT NULL DEFAULT '',
+  is_system    BOOLEAN NOT NULL DEFAULT false,
+  created_at   TIMESTAMPTZ DEFAULT now()
+);
+
+-- Permissions checked by the services, named <resource>:<action>
+CREATE TABLE permissions (
+  permission_name  TEXT PRIMARY KEY,
+  description      TEXT NOT NULL DEFAULT ''
+);
+
+-- Permissions granted to each role
+CREATE TABLE role_permissions (
+  role_name        TEXT REFERENCES roles(role_name) ON DELETE CASCADE,
+  permission_name  TEXT REFERENCES permissions(permission_name) ON DELETE CASCADE,
+  PRIMARY KEY (role_name, permission_name)
+);
+
+INSERT INTO roles (role_name, description, is_system) VALUES
+('admin', 'Full access to the system', true),
+('bartender', 'Prepares cocktails and processes orders', true),
+('guest', 'Browses cocktails and places orders', true);
+
+INSERT INTO permissions (permission_name, description) VALUES
+('users:read', 'View other users'),
+('users:write', 'Create and update other users'),
+('users:delete', 'Delete users'),
+('users:security', 'Revoke sessions, unlock accounts, reset two-factor authentication and set PINs'),
+('roles:manage', 'Manage roles and permissions'),
+('terminals:manage', 'Register and revoke POS terminals'),
+('api_clients:manage', 'Manage machine clients and their API keys'),
+('inventory:read', 'View ingredients and stock levels'),
+('inventory:adjust', 'Adjust stock levels'),
+('inventory:write', 'Manage ingredients and prices'),
+('recipes:read', 'View recipes'),
+('recipes:write', 'Manage recipes'),
+('orders:read', 'View orders'),
+('orders:create', 'Place orders'),
+('orders:process', 'Prepare and complete orders'),
+('orders:refund', 'Refund orders'),
+('reports:read', 'View reports');
+
+-- Admins get every permission
+INSERT INTO role_permissions (role_name, permission_name)
+SELECT 'admin', permission_name FROM permissions;
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+('bartender', 'inventory:read'),
+('bartender', 'inventory:adjust'),
+('bartender', 'recipes:read'),
+('bartender', 'orders:read'),
+('bartender', 'orders:create'),
+('bartender', 'orders:process'),
+('guest', 'recipes:read'),
+('guest', 'orders:create');
+
+-- Roles are now data: replace the hard-coded CHECK constraint with a foreign key
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(role_name) ON UPDATE CASCADE;
+
+-- Create indexes for performance
+CREATE INDEX idx_role_permissions_permission_name ON role_permissions(permission_name);
@@ -0,0 +1,3 @@
+-- Migration: drop password reset tokens
+
+DROP TABLE IF EXISTS password_reset_tokens;
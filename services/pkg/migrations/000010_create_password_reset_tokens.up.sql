@@ -0,0 +1,16 @@
+-- Migration: self-service password reset
+
+-- Password reset tokens. Only a SHA-256 hash of each token is stored and a
+-- token can be used once.
+CREATE TABLE password_reset_tokens (
+  token_id      SERIAL PRIMARY KEY,
+  user_id       INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  token_hash    TEXT UNIQUE NOT NULL,
+  expires_at    TIMESTAMPTZ NOT NULL,
+  used_at       TIMESTAMPTZ,
+  requested_ip  TEXT,
+  created_at    TIMESTAMPTZ DEFAULT now()
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,3 @@
+-- Migration: drop password history
+
+DROP TABLE IF EXISTS password_history;
@@ -0,0 +1,12 @@
+-- Migration: password history
+
+-- Previous password hashes of each user, used to prevent password reuse
+CREATE TABLE password_history (
+  history_id     SERIAL PRIMARY KEY,
+  user_id        INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  password_hash  TEXT NOT NULL,
+  created_at     TIMESTAMPTZ DEFAULT now()
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_password_history_user_id ON password_history(user_id, created_at DESC);
@@ -0,0 +1,3 @@
+-- Migration: drop user invitations
+
+DROP TABLE IF EXISTS invitations;
@@ -0,0 +1,24 @@
+-- Migration: user invitations
+
+-- Invitations to join with a given role. Only a SHA-256 hash of the invite
+-- token is stored; the invitee chooses a username and password on acceptance.
+CREATE TABLE invitations (
+  invitation_id  SERIAL PRIMARY KEY,
+  email          TEXT NOT NULL,
+  role           TEXT NOT NULL REFERENCES roles(role_name) ON UPDATE CASCADE ON DELETE CASCADE,
+  token_hash     TEXT UNIQUE NOT NULL,
+  invited_by     INT REFERENCES users(user_id) ON DELETE SET NULL,
+  expires_at     TIMESTAMPTZ NOT NULL,
+  sent_at        TIMESTAMPTZ DEFAULT now(),
+  accepted_at    TIMESTAMPTZ,
+  user_id        INT REFERENCES users(user_id) ON DELETE SET NULL,
+  revoked_at     TIMESTAMPTZ,
+  created_at     TIMESTAMPTZ DEFAULT now()
+);
+
+-- Only one open invitation per address
+CREATE UNIQUE INDEX idx_invitations_open_email ON invitations(LOWER(email))
+  WHERE accepted_at IS NULL AND revoked_at IS NULL;
+
+-- Create indexes for performance
+CREATE INDEX idx_invitations_created_at ON invitations(created_at DESC);
@@ -0,0 +1,9 @@
+-- Migration: drop soft-deactivation of users
+
+DELETE FROM role_permissions WHERE permission_name = 'users:erase';
+DELETE FROM permissions WHERE permission_name = 'users:erase';
+UPDATE permissions SET description = 'Delete users' WHERE permission_name = 'users:delete';
+
+DROP INDEX IF EXISTS idx_users_active;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS active;
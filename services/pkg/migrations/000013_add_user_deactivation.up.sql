@@ -0,0 +1,18 @@
+-- Migration: soft-deactivation of users
+
+-- Deactivated users keep their row, so orders and inventory transactions
+-- still show who made them, but they can no longer log in
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMPTZ;
+
+-- Deleting a user is now a separate, admin-only erase operation
+UPDATE permissions SET description = 'Deactivate and reactivate users' WHERE permission_name = 'users:delete';
+
+INSERT INTO permissions (permission_name, description) VALUES
+('users:erase', 'Permanently erase deactivated users');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+('admin', 'users:erase');
+
+-- Create indexes for performance
+CREATE INDEX idx_users_active ON users(active);
@@ -0,0 +1,6 @@
+-- Migration: drop user list indexes
+
+DROP INDEX IF EXISTS idx_users_role;
+DROP INDEX IF EXISTS idx_users_created_at;
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
@@ -0,0 +1,11 @@
+-- Migration: indexes for searching and sorting user lists
+
+-- Trigram indexes make substring searches (ILIKE '%term%') on usernames and
+-- e-mail addresses use an index
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Create indexes for performance
+CREATE INDEX idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
+CREATE INDEX idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
+CREATE INDEX idx_users_created_at ON users(created_at, user_id);
+CREATE INDEX idx_users_role ON users(role, user_id);
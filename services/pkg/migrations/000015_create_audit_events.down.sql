@@ -0,0 +1,7 @@
+-- Migration: drop audit log
+
+DELETE FROM role_permissions WHERE permission_name = 'audit:read';
+DELETE FROM permissions WHERE permission_name = 'audit:read';
+
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
@@ -0,0 +1,43 @@
+-- Migration: audit log
+
+-- Security-relevant and administrative actions. Actors are stored by ID and
+-- name without a foreign key, so events outlive erased users.
+CREATE TABLE audit_events (
+  event_id     BIGSERIAL PRIMARY KEY,
+  occurred_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  actor_id     INT,
+  actor_name   TEXT,
+  action       TEXT NOT NULL,
+  target_type  TEXT,
+  target_id    TEXT,
+  changes      JSONB,
+  ip           TEXT,
+  user_agent   TEXT
+);
+
+-- The audit log is append-only
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update
+  BEFORE UPDATE OR DELETE ON audit_events
+  FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+  BEFORE TRUNCATE ON audit_events
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (permission_name, description) VALUES
+('audit:read', 'View and export the audit log');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+('admin', 'audit:read');
+
+-- Create indexes for performance
+CREATE INDEX idx_audit_events_occurred_at ON audit_events(occurred_at DESC);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id, occurred_at DESC);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id, occurred_at DESC);
+CREATE INDEX idx_audit_events_action ON audit_events(action, occurred_at DESC);
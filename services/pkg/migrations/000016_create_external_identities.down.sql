@@ -0,0 +1,4 @@
+-- Migration: drop external identity provider logins
+
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS external_identities;
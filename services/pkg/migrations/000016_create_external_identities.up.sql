@@ -0,0 +1,29 @@
+-- Migration: external identity provider logins
+
+-- Accounts at OpenID Connect providers linked to users. The subject is the
+-- stable ID the provider issues for the account; e-mail addresses can change.
+CREATE TABLE external_identities (
+  identity_id    SERIAL PRIMARY KEY,
+  user_id        INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  provider       TEXT NOT NULL,
+  subject        TEXT NOT NULL,
+  email          TEXT,
+  created_at     TIMESTAMPTZ DEFAULT now(),
+  last_login_at  TIMESTAMPTZ,
+  UNIQUE (provider, subject)
+);
+
+-- Pending authorization requests. Only a SHA-256 hash of the state is stored;
+-- the PKCE code verifier and nonce never leave the server.
+CREATE TABLE oidc_login_states (
+  state_hash     TEXT PRIMARY KEY,
+  provider       TEXT NOT NULL,
+  code_verifier  TEXT NOT NULL,
+  nonce          TEXT NOT NULL,
+  expires_at     TIMESTAMPTZ NOT NULL,
+  created_at     TIMESTAMPTZ DEFAULT now()
+);
+
+-- Create indexes for performance
+CREATE INDEX idx_external_identities_user_id ON external_identities(user_id);
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
@@ -0,0 +1,6 @@
+-- Migration: drop service token audiences and token introspection
+
+DELETE FROM role_permissions WHERE permission_name = 'tokens:introspect';
+DELETE FROM permissions WHERE permission_name = 'tokens:introspect';
+
+ALTER TABLE api_clients DROP COLUMN IF EXISTS audiences;
@@ -0,0 +1,10 @@
+-- Migration: service token audiences and token introspection
+
+-- Services a machine client may request client credentials tokens for
+ALTER TABLE api_clients ADD COLUMN audiences TEXT[] NOT NULL DEFAULT '{}';
+
+INSERT INTO permissions (permission_name, description) VALUES
+('tokens:introspect', 'Check whether tokens and API keys are active');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+('admin', 'tokens:introspect');
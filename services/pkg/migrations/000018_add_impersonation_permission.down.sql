@@ -0,0 +1,4 @@
+-- Migration: drop permission to impersonate users
+
+DELETE FROM role_permissions WHERE permission_name = 'users:impersonate';
+DELETE FROM permissions WHERE permission_name = 'users:impersonate';
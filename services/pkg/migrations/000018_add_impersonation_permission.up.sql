@@ -0,0 +1,7 @@
+-- Migration: permission to impersonate users
+
+INSERT INTO permissions (permission_name, description) VALUES
+('users:impersonate', 'Act as another user to see the app as they do');
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+('admin', 'users:impersonate');
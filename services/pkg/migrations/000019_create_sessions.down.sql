@@ -0,0 +1,3 @@
+-- Migration: drop sessions
+
+DROP TABLE IF EXISTS sessions;
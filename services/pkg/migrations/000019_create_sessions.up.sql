@@ -0,0 +1,26 @@
+-- Migration: sessions of users on their devices
+
+-- A session is a login on a device. Its ID is the family_id of its refresh
+-- tokens and the sid claim of its access tokens, so revoking a session
+-- rejects both.
+CREATE TABLE sessions (
+  session_id    UUID PRIMARY KEY,
+  user_id       INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  device_name   TEXT,
+  ip            TEXT,
+  user_agent    TEXT,
+  auth_methods  TEXT[] NOT NULL DEFAULT '{}',
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at    TIMESTAMPTZ
+);
+
+-- Sessions of logins made before this migration, without device details
+INSERT INTO sessions (session_id, user_id, created_at, last_seen_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > now()
+GROUP BY family_id, user_id;
+
+-- Create indexes for performance
+CREATE INDEX idx_sessions_user_id ON sessions(user_id, last_seen_at DESC);
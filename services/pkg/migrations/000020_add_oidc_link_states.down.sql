@@ -0,0 +1,3 @@
+-- Migration: drop linking provider accounts from an authenticated session
+
+ALTER TABLE oidc_login_states DROP COLUMN IF EXISTS user_id;
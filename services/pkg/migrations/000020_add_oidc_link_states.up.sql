@@ -0,0 +1,6 @@
+-- Migration: linking provider accounts from an authenticated session
+
+-- Logins started by a logged in user to link a provider account to
+-- themselves. Such states cannot be used to log in.
+ALTER TABLE oidc_login_states
+  ADD COLUMN user_id INT REFERENCES users(user_id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- Migration: drop passwords users must replace at their next login
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_change_required;
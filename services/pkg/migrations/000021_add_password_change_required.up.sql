@@ -0,0 +1,5 @@
+-- Migration: passwords users must replace at their next login
+
+-- Set for users whose password was chosen by an admin, e.g. in a CSV import.
+-- Logins then only continue once the user has set a password of their own.
+ALTER TABLE users ADD COLUMN password_change_required BOOLEAN NOT NULL DEFAULT false;
@@ -13,6 +13,73 @@ type User struct {
 	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Deactivated users cannot log in but are kept for the history of their orders
+	Active        bool       `json:"active"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+
+	// Users whose password was chosen by an admin must replace it at their next login
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+// User statuses used to filter user lists
+const (
+	UserStatusActive      = "active"
+	UserStatusDeactivated = "deactivated"
+)
+
+// UserListQuery filters, sorts and paginates user lists
+type UserListQuery struct {
+	// Search matches a part of the username or e-mail address, ignoring case
+	Search      string
+	Role        string
+	Status      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Sort is username (default), email, role or created_at
+	Sort string
+	// Desc sorts in descending order
+	Desc   bool
+	Limit  int
+	Offset int
+	// After continues a listing after the user with this sort value and ID
+	// (keyset pagination); Offset is ignored when it is set
+	After *UserCursor
+}
+
+// UserCursor is the position of a user in a sorted user list
+type UserCursor struct {
+	Value string
+	ID    int
+}
+
+// UserPage is one page of a user list
+type UserPage struct {
+	Users      []User `json:"users"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// UserImportResult reports the outcome of a CSV user import. Rows are only
+// stored when no row has errors.
+type UserImportResult struct {
+	DryRun      bool              `json:"dry_run"`
+	Rows        int               `json:"rows"`
+	Created     int               `json:"created"`
+	Invited     int               `json:"invited"`
+	Errors      []UserImportError `json:"errors"`
+	Users       []User            `json:"users,omitempty"`
+	Invitations []Invitation      `json:"invitations,omitempty"`
+}
+
+// UserImportError is a problem with one row of a CSV user import
+type UserImportError struct {
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Error    string `json:"error"`
 }
 
 // Ingredient represents a cocktail ingredient
@@ -118,13 +185,304 @@ type BartenderSkill struct {
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// DeviceName labels the session, e.g. "Bar tablet"; derived from the user agent if empty
+	DeviceName string `json:"device_name,omitempty"`
 }
 
-// LoginResponse represents a successful login
+// LoginResponse represents a successful login. When a second factor is
+// required no tokens are issued; MFAToken must be exchanged via /login/mfa.
 type LoginResponse struct {
-	Token        string `json:"token"`
-	RefreshToken string `json:"refresh_token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 	User         User   `json:"user"`
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`
+
+	PasswordChangeRequired bool   `json:"password_change_required,omitempty"`
+	PasswordChangeToken    string `json:"password_change_token,omitempty"`
+}
+
+// ImpersonationResponse carries a short-lived token for acting as another user.
+// It has no refresh token; the admin starts over once it expires.
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+	ActorID   int       `json:"actor_id"`
+}
+
+// MFALoginRequest exchanges an MFA challenge token and a code for tokens
+type MFALoginRequest struct {
+	MFAToken   string `json:"mfa_token"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// PasswordChangeLoginRequest exchanges a password change token and a new
+// password for tokens
+type PasswordChangeLoginRequest struct {
+	PasswordChangeToken string `json:"password_change_token"`
+	NewPassword         string `json:"new_password"`
+	DeviceName          string `json:"device_name,omitempty"`
+}
+
+// UserMFA represents the TOTP enrollment of a user
+type UserMFA struct {
+	UserID       int        `json:"user_id"`
+	TOTPSecret   string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// MFAEnrollment is returned when a user starts TOTP enrollment
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// RefreshToken represents a stored refresh token. Only the hash of the token
+// is persisted; the raw value is returned to the client once.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Session is a login of a user on a device. It lasts as long as its refresh tokens.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      int       `json:"user_id"`
+	DeviceName  string    `json:"device_name,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	AuthMethods []string  `json:"auth_methods"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// Current marks the session of the token the list was requested with
+	Current bool `json:"current"`
+}
+
+// LoginAttempt tracks failed logins for a username or client IP
+type LoginAttempt struct {
+	Scope        string     `json:"scope"`
+	Key          string     `json:"key"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+// Terminal represents a registered POS terminal that accepts PIN logins
+type Terminal struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	KeyHash    string     `json:"-"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Key is only set in the response that registers the terminal
+	Key string `json:"key,omitempty"`
+}
+
+// PINLoginRequest represents a quick PIN login on a terminal. Either the user
+// ID (e.g. from a staff tile) or the username identifies the user.
+type PINLoginRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	PIN      string `json:"pin"`
+}
+
+// APIClient represents a machine client that authenticates with an API key
+type APIClient struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Audiences  []string   `json:"audiences"`
+	KeyPrefix  string     `json:"key_prefix"`
+	KeyHash    string     `json:"-"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Key is only set in the responses that create the client or rotate its key
+	Key string `json:"key,omitempty"`
+}
+
+// APIClientRequest represents a request to register a machine client
+type APIClientRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Audiences []string   `json:"audiences"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ClientTokenResponse is the response of the OAuth token endpoint (RFC 6749)
+type ClientTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Role represents a named set of permissions that users can be assigned
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	System      bool      `json:"system"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission represents an action that services check before allowing a request
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PasswordResetToken is a single-use token that lets a user choose a new password
+type PasswordResetToken struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	TokenHash   string     `json:"-"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+	RequestedIP string     `json:"requested_ip,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ForgotPasswordRequest represents a request for a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents a password reset with a token from the reset link
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// UpdateUserRequest represents an update of a user. Users changing their own
+// email address must confirm it with their current password.
+type UpdateUserRequest struct {
+	User
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// ChangePasswordRequest represents a password change by the logged in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordSchemeCount is the number of users whose password hash uses a scheme
+// with the given parameters. Current is false for hashes that will be
+// upgraded at the next login.
+type PasswordSchemeCount struct {
+	Scheme  string `json:"scheme"`
+	Params  string `json:"params,omitempty"`
+	Current bool   `json:"current"`
+	Users   int    `json:"users"`
+}
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationExpired  = "expired"
+	InvitationRevoked  = "revoked"
+)
+
+// Invitation invites an e-mail address to create an account with a role
+type Invitation struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  *int       `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	SentAt     time.Time  `json:"sent_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	UserID     *int       `json:"user_id,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// InvitationRequest represents a request to invite a new user
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// AcceptInvitationRequest represents the account details chosen by an invitee
+type AcceptInvitationRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ExternalIdentity links an account at an OpenID Connect provider to a user
+type ExternalIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCLoginState is a pending authorization request at an OpenID Connect
+// provider. Only the hash of the state is persisted.
+type OIDCLoginState struct {
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	// LinkUserID is the logged in user a link was started by; nil for logins
+	LinkUserID *int
+}
+
+// OIDCProvider describes a configured OpenID Connect provider users can log in with
+type OIDCProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// OIDCAuthorization is the provider URL the browser is sent to for an
+// external login, together with the state it returns with
+type OIDCAuthorization struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// OIDCLinkRequest confirms the start of a link with the current password of
+// the user or, with two-factor authentication, a current code
+type OIDCLinkRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+// OIDCCallbackRequest carries the code and state the provider redirected back with
+type OIDCCallbackRequest struct {
+	Code       string `json:"code"`
+	State      string `json:"state"`
+	DeviceName string `json:"device_name,omitempty"`
 }
 
 // RecipeCost represents a calculated recipe cost
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ignaseim/bartenderapp/services/pkg/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// untracedPaths are requested every few seconds by Prometheus and probes
+var untracedPaths = map[string]bool{
+	"/metrics": true,
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+}
+
+// Middleware starts a server span for every request, continuing the trace
+// of the caller. Spans are named after the method and route template, such
+// as "GET /users/{id}", and the trace ID is added to the log lines of the
+// request as trace_id. Register it with router.Use after logging.RequestID.
+// Metric scrapes and health probes are not traced.
+func Middleware(next http.Handler) http.Handler {
+	traced := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Replace the path recorded by otelhttp with the route, since paths
+		// such as /invitations/{token}/accept carry secrets
+		if route := routeTemplate(r); route != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				semconv.HTTPRoute(route),
+				semconv.URLPath(route),
+				attribute.String("http.target", route),
+			)
+		}
+		if traceID := TraceID(r.Context()); traceID != "" {
+			logging.AddAttrs(r.Context(), "trace_id", traceID)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return otelhttp.NewHandler(traced, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if route := routeTemplate(r); route != "" {
+				return r.Method + " " + route
+			}
+			return r.Method
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !untracedPaths[r.URL.Path]
+		}),
+	)
+}
+
+// NewClient creates an HTTP client for calls to other services. Its requests
+// get client spans and carry the trace context of the request context, so
+// build them with http.NewRequestWithContext.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: Transport(http.DefaultTransport),
+	}
+}
+
+// Transport wraps base so requests made through it are traced
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Host
+		}),
+	)
+}
+
+// routeTemplate returns the template of the mux route a request matched
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareRedactsPath(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/invitations/{token}/accept", func(w http.ResponseWriter, r *http.Request) {})
+
+	const token = "secret-invite-token"
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/invitations/"+token+"/accept", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+
+	span := spans[0]
+	if want := "POST /invitations/{token}/accept"; span.Name() != want {
+		t.Errorf("span name = %q, want %q", span.Name(), want)
+	}
+	for _, attr := range span.Attributes() {
+		if strings.Contains(attr.Value.Emit(), token) {
+			t.Errorf("attribute %s contains the token: %q", attr.Key, attr.Value.Emit())
+		}
+	}
+}
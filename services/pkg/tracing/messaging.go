@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// messagingSystem is the messaging.system of NATS spans
+var messagingSystem = semconv.MessagingSystemKey.String("nats")
+
+// StartPublish starts a producer span for a message to subject and writes
+// the trace context into its headers. header is the Header of a nats.Msg,
+// which must be non-nil; end the span once the message is published:
+//
+//	msg := nats.NewMsg(subject)
+//	ctx, span := tracing.StartPublish(ctx, subject, msg.Header)
+//	defer span.End()
+func StartPublish(ctx context.Context, subject string, header map[string][]string) (context.Context, trace.Span) {
+	ctx, span := tracer().Start(ctx, "publish "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			messagingSystem,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+
+	otel.GetTextMapPropagator().Inject(ctx, messageCarrier(header))
+	return ctx, span
+}
+
+// StartProcess starts a consumer span for a message received on subject,
+// continuing the trace of the publisher from the message headers. The
+// returned context carries the span; end it once the message is handled.
+func StartProcess(ctx context.Context, subject string, header map[string][]string) (context.Context, trace.Span) {
+	if header != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, messageCarrier(header))
+	}
+
+	return tracer().Start(ctx, "process "+subject,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			messagingSystem,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(subject),
+		),
+	)
+}
+
+// messageCarrier adapts NATS message headers to the propagator. Unlike
+// http.Header, NATS keeps header names as written, so keys are stored as
+// given and looked up case-insensitively.
+type messageCarrier map[string][]string
+
+var _ propagation.TextMapCarrier = messageCarrier(nil)
+
+func (c messageCarrier) Get(key string) string {
+	if values := c[key]; len(values) > 0 {
+		return values[0]
+	}
+	for name, values := range c {
+		if strings.EqualFold(name, key) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func (c messageCarrier) Set(key, value string) {
+	c[key] = []string{value}
+}
+
+func (c messageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
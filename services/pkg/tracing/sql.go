@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errNamedArgs is returned for named arguments to drivers without support for them
+var errNamedArgs = errors.New("the database driver does not support named arguments")
+
+// WrapConnector traces the queries and statements run over connections of
+// connector. Open the database with sql.OpenDB(tracing.WrapConnector(c)).
+// Spans are only created below a span of the context, e.g. the request
+// span, so only queries run with QueryContext, ExecContext and friends are
+// traced and background work does not start a trace per query.
+func WrapConnector(connector driver.Connector) driver.Connector {
+	return &tracedConnector{connector: connector}
+}
+
+// tracedConnector wraps a driver.Connector to return traced connections
+type tracedConnector struct {
+	connector driver.Connector
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn: conn}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// tracedConn wraps a driver.Conn to trace queries and statements. Methods
+// the wrapped connection lacks fall back to what database/sql does without
+// them.
+type tracedConn struct {
+	conn driver.Conn
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{stmt: stmt, query: query}, nil
+}
+
+func (c *tracedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tracedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	endQuerySpan(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	endQuerySpan(span, err)
+	return result, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// tracedStmt wraps a prepared statement to trace its executions
+type tracedStmt struct {
+	stmt  driver.Stmt
+	query string
+}
+
+func (s *tracedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *tracedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *tracedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *tracedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startQuerySpan(ctx, s.query)
+
+	var result driver.Result
+	var err error
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.stmt.Exec(values)
+		}
+	}
+
+	endQuerySpan(span, err)
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startQuerySpan(ctx, s.query)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+
+	endQuerySpan(span, err)
+	return rows, err
+}
+
+// startQuerySpan starts a client span for a query below the span of ctx.
+// Without one it returns a span that records nothing.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	operation := queryOperation(query)
+	return tracer().Start(ctx, "db "+strings.ToLower(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// endQuerySpan ends a query span, marking it failed on errors
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryOperation returns the first keyword of a query, such as SELECT
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// namedValues converts arguments for drivers that only take positional values
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errNamedArgs
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeConnector hands out connections that answer every statement with err
+type fakeConnector struct {
+	err error
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn(c), nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	err error
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func TestWrapConnectorSpans(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	failure := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		parent   bool
+		err      error
+		wantSpan bool
+	}{
+		{"below a request span", true, nil, true},
+		{"failed query", true, failure, true},
+		{"without a span", false, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			otel.SetTracerProvider(provider)
+
+			db := sql.OpenDB(WrapConnector(fakeConnector{err: tt.err}))
+			defer db.Close()
+
+			ctx := context.Background()
+			if tt.parent {
+				var parent trace.Span
+				ctx, parent = provider.Tracer("test").Start(ctx, "request")
+				defer parent.End()
+			}
+
+			if _, err := db.ExecContext(ctx, "UPDATE users SET active = $1", true); !errors.Is(err, tt.err) {
+				t.Fatalf("ExecContext() error = %v, want %v", err, tt.err)
+			}
+
+			spans := recorder.Ended()
+			if !tt.wantSpan {
+				if len(spans) != 0 {
+					t.Fatalf("got %d spans, want none", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+
+			span := spans[0]
+			if want := "db update"; span.Name() != want {
+				t.Errorf("span name = %q, want %q", span.Name(), want)
+			}
+			if span.Parent().SpanID() != trace.SpanContextFromContext(ctx).SpanID() {
+				t.Errorf("span is not a child of the request span")
+			}
+			if failed := span.Status().Code == codes.Error; failed != (tt.err != nil) {
+				t.Errorf("span status = %v, want failed %v", span.Status().Code, tt.err != nil)
+			}
+		})
+	}
+}
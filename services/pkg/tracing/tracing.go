@@ -0,0 +1,90 @@
+// Package tracing sets up OpenTelemetry tracing of the services. Spans of
+// incoming and outgoing HTTP requests, database queries and NATS messages
+// share the W3C trace context, so a call chain such as order → pricing →
+// inventory shows up as one trace.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the spans created by this package
+const instrumentationName = "github.com/ignaseim/bartenderapp/services/pkg/tracing"
+
+// Enabled reports whether spans are exported. Tracing is on when an OTLP
+// endpoint is configured with OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, unless OTEL_SDK_DISABLED is true.
+func Enabled() bool {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs the global tracer provider of the service, exporting spans
+// over OTLP/HTTP in batches. The standard OTEL_* variables configure the
+// exporter and sampler (parent based, always on by default). The trace
+// context is propagated even with tracing disabled, so a service without an
+// exporter does not break the traces of others. Call the returned function on
+// shutdown to flush pending spans.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !Enabled() {
+		slog.Info("Tracing disabled, set OTEL_EXPORTER_OTLP_ENDPOINT to export spans")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	slog.Info("Tracing enabled", "service", service)
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of the spans created by this package
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceID returns the ID of the trace of ctx, if it has one
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}